@@ -1,11 +1,82 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
 	Port string
+	// InsecureRegistries lists registry hosts accessed over plain HTTP
+	InsecureRegistries []string
+	// CredentialsFile is an optional YAML/JSON file with per-registry credentials
+	CredentialsFile string
+	// DockerConfigPath is the Docker config.json used as a fallback source of credentials
+	DockerConfigPath string
+	// Credentials is populated by LoadCredentials
+	Credentials *CredentialsStore
+	// RulesFile is an optional YAML/JSON file with image extraction rules
+	RulesFile string
+	// ExtractionRules is populated by LoadExtractionRules
+	ExtractionRules []ExtractionRule
+	// LookupConcurrency is the number of images looked up at a time for one request
+	LookupConcurrency int
+	// MaxConcurrentLookups is the number of images looked up at a time across all requests
+	MaxConcurrentLookups int
+	// ConnectTimeout bounds connecting to upstream servers
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the wait for upstream response headers
+	ReadTimeout time.Duration
+	// RequestTimeout is the time budget of one API request
+	RequestTimeout time.Duration
+	// CacheFile is an optional file persisting the image metadata cache
+	CacheFile string
+	// CacheSize is the number of entries of the in-memory cache
+	CacheSize int
+	// CacheTagTTL is how long the digests of image tags are cached
+	CacheTagTTL time.Duration
+	// RetryAttempts is the number of attempts of registry requests
+	RetryAttempts int
+	// RetryBaseDelay and RetryMaxDelay bound the backoff between attempts
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerThreshold is the number of consecutive failures that open the circuit of a registry
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit of a registry stays open
+	BreakerCooldown time.Duration
+	// RateLimits are the token buckets throttling requests per registry host
+	RateLimits map[string]RateLimit
+	// LowQuota is the remaining registry quota below which requests are paced
+	LowQuota int
 }
 
+// RateLimit is the token bucket of a registry: Rate requests per second,
+// with bursts of up to Burst requests
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Defaults of the settings, also used by the services and handlers created
+// without a Config
+const (
+	DefaultLookupConcurrency    = 8
+	DefaultMaxConcurrentLookups = 32
+	DefaultConnectTimeout       = 10 * time.Second
+	DefaultReadTimeout          = 30 * time.Second
+	DefaultRequestTimeout       = 2 * time.Minute
+	DefaultCacheSize            = 10000
+	DefaultCacheTagTTL          = 10 * time.Minute
+	DefaultRetryAttempts        = 3
+	DefaultRetryBaseDelay       = 200 * time.Millisecond
+	DefaultRetryMaxDelay        = 5 * time.Second
+	DefaultBreakerThreshold     = 5
+	DefaultBreakerCooldown      = 30 * time.Second
+	DefaultLowQuota             = 10
+)
+
 func NewConfig() *Config {
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -13,6 +84,121 @@ func NewConfig() *Config {
 	}
 
 	return &Config{
-		Port: port,
+		Port:               port,
+		InsecureRegistries: splitList(os.Getenv("INSECURE_REGISTRIES")),
+		CredentialsFile:    os.Getenv("REGISTRY_CREDENTIALS_FILE"),
+		DockerConfigPath:   defaultDockerConfigPath(),
+		RulesFile:          os.Getenv("EXTRACTION_RULES_FILE"),
+
+		LookupConcurrency:    positiveInt(os.Getenv("LOOKUP_CONCURRENCY"), DefaultLookupConcurrency),
+		MaxConcurrentLookups: positiveInt(os.Getenv("MAX_CONCURRENT_LOOKUPS"), DefaultMaxConcurrentLookups),
+
+		ConnectTimeout: positiveDuration(os.Getenv("CONNECT_TIMEOUT"), DefaultConnectTimeout),
+		ReadTimeout:    positiveDuration(os.Getenv("READ_TIMEOUT"), DefaultReadTimeout),
+		RequestTimeout: positiveDuration(os.Getenv("REQUEST_TIMEOUT"), DefaultRequestTimeout),
+
+		CacheFile:   os.Getenv("CACHE_FILE"),
+		CacheSize:   positiveInt(os.Getenv("CACHE_SIZE"), DefaultCacheSize),
+		CacheTagTTL: positiveDuration(os.Getenv("CACHE_TAG_TTL"), DefaultCacheTagTTL),
+
+		RetryAttempts:    positiveInt(os.Getenv("RETRY_ATTEMPTS"), DefaultRetryAttempts),
+		RetryBaseDelay:   positiveDuration(os.Getenv("RETRY_BASE_DELAY"), DefaultRetryBaseDelay),
+		RetryMaxDelay:    positiveDuration(os.Getenv("RETRY_MAX_DELAY"), DefaultRetryMaxDelay),
+		BreakerThreshold: positiveInt(os.Getenv("BREAKER_THRESHOLD"), DefaultBreakerThreshold),
+		BreakerCooldown:  positiveDuration(os.Getenv("BREAKER_COOLDOWN"), DefaultBreakerCooldown),
+
+		RateLimits: parseRateLimits(os.Getenv("REGISTRY_RATE_LIMITS")),
+		LowQuota:   positiveInt(os.Getenv("REGISTRY_LOW_QUOTA"), DefaultLowQuota),
+	}
+}
+
+// LoadCredentials builds the registry credentials store from the credentials
+// file and the Docker config; credentials file entries take precedence
+func (c *Config) LoadCredentials() error {
+	store := NewCredentialsStore()
+
+	if c.CredentialsFile != "" {
+		if err := store.LoadCredentialsFile(c.CredentialsFile); err != nil {
+			return err
+		}
+	}
+	if c.DockerConfigPath != "" {
+		if err := store.LoadDockerConfig(c.DockerConfigPath); err != nil {
+			return err
+		}
+	}
+
+	c.Credentials = store
+	return nil
+}
+
+// LoadExtractionRules loads the image extraction rules from the rules file, if any
+func (c *Config) LoadExtractionRules() error {
+	if c.RulesFile == "" {
+		return nil
+	}
+
+	rules, err := LoadExtractionRules(c.RulesFile)
+	if err != nil {
+		return err
+	}
+	c.ExtractionRules = rules
+	return nil
+}
+
+// splitList splits a comma-separated environment value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// positiveInt parses a positive integer environment value, falling back to
+// def when it is unset or invalid
+func positiveInt(value string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// positiveDuration parses a positive duration environment value such as
+// "30s", falling back to def when it is unset or invalid
+func positiveDuration(value string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// parseRateLimits parses comma-separated "host=rate[:burst]" items such as
+// "docker.io=2:5,ghcr.io=10", skipping invalid ones; the burst defaults to 1
+func parseRateLimits(value string) map[string]RateLimit {
+	limits := map[string]RateLimit{}
+	for _, item := range splitList(value) {
+		host, spec, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(host) == "" {
+			continue
+		}
+		rateValue, burstValue, hasBurst := strings.Cut(spec, ":")
+
+		limit := RateLimit{Burst: 1}
+		var err error
+		if limit.Rate, err = strconv.ParseFloat(strings.TrimSpace(rateValue), 64); err != nil || limit.Rate <= 0 {
+			continue
+		}
+		if hasBurst {
+			if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burstValue)); err != nil || limit.Burst < 1 {
+				continue
+			}
+		}
+		limits[strings.TrimSpace(host)] = limit
 	}
+	return limits
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -42,3 +43,78 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfig_InsecureRegistries(t *testing.T) {
+	original := os.Getenv("INSECURE_REGISTRIES")
+	defer os.Setenv("INSECURE_REGISTRIES", original)
+
+	os.Setenv("INSECURE_REGISTRIES", "localhost:5000, registry.internal:5000,")
+
+	config := NewConfig()
+	require.Equal(t, []string{"localhost:5000", "registry.internal:5000"}, config.InsecureRegistries)
+}
+
+func TestNewConfig_LookupConcurrency(t *testing.T) {
+	for _, name := range []string{"LOOKUP_CONCURRENCY", "MAX_CONCURRENT_LOOKUPS"} {
+		original := os.Getenv(name)
+		defer os.Setenv(name, original)
+	}
+
+	os.Setenv("LOOKUP_CONCURRENCY", "4")
+	os.Setenv("MAX_CONCURRENT_LOOKUPS", "invalid")
+
+	config := NewConfig()
+	require.Equal(t, 4, config.LookupConcurrency)
+	require.Equal(t, DefaultMaxConcurrentLookups, config.MaxConcurrentLookups)
+}
+
+func TestNewConfig_Timeouts(t *testing.T) {
+	for _, name := range []string{"CONNECT_TIMEOUT", "READ_TIMEOUT", "REQUEST_TIMEOUT"} {
+		original := os.Getenv(name)
+		defer os.Setenv(name, original)
+	}
+
+	os.Setenv("CONNECT_TIMEOUT", "2s")
+	os.Setenv("READ_TIMEOUT", "")
+	os.Setenv("REQUEST_TIMEOUT", "-1m")
+
+	config := NewConfig()
+	require.Equal(t, 2*time.Second, config.ConnectTimeout)
+	require.Equal(t, DefaultReadTimeout, config.ReadTimeout)
+	require.Equal(t, DefaultRequestTimeout, config.RequestTimeout)
+}
+
+func TestNewConfig_Retries(t *testing.T) {
+	for _, name := range []string{"RETRY_ATTEMPTS", "RETRY_MAX_DELAY", "BREAKER_COOLDOWN"} {
+		original := os.Getenv(name)
+		defer os.Setenv(name, original)
+	}
+
+	os.Setenv("RETRY_ATTEMPTS", "5")
+	os.Setenv("RETRY_MAX_DELAY", "1s")
+	os.Setenv("BREAKER_COOLDOWN", "0s")
+
+	config := NewConfig()
+	require.Equal(t, 5, config.RetryAttempts)
+	require.Equal(t, time.Second, config.RetryMaxDelay)
+	require.Equal(t, DefaultRetryBaseDelay, config.RetryBaseDelay)
+	require.Equal(t, DefaultBreakerCooldown, config.BreakerCooldown)
+	require.Equal(t, DefaultBreakerThreshold, config.BreakerThreshold)
+}
+
+func TestNewConfig_RateLimits(t *testing.T) {
+	for _, name := range []string{"REGISTRY_RATE_LIMITS", "REGISTRY_LOW_QUOTA"} {
+		original := os.Getenv(name)
+		defer os.Setenv(name, original)
+	}
+
+	os.Setenv("REGISTRY_RATE_LIMITS", "docker.io=2:5, ghcr.io=10, quay.io=fast, gcr.io=0")
+	os.Setenv("REGISTRY_LOW_QUOTA", "20")
+
+	config := NewConfig()
+	require.Equal(t, map[string]RateLimit{
+		"docker.io": {Rate: 2, Burst: 5},
+		"ghcr.io":   {Rate: 10, Burst: 1},
+	}, config.RateLimits)
+	require.Equal(t, 20, config.LowQuota)
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dockerHubServerURL is the key Docker uses for Docker Hub in config.json and credential helpers
+const dockerHubServerURL = "https://index.docker.io/v1/"
+
+// credentialHelperTimeout bounds a credential helper run, e.g. one waiting
+// for a locked keychain
+const credentialHelperTimeout = 30 * time.Second
+
+// Credentials holds authentication data for a single registry. Username and
+// Password are used for basic auth and token requests, IdentityToken is an
+// OAuth2 refresh token exchanged for access tokens, and RegistryToken is a
+// bearer token sent to the registry as is.
+type Credentials struct {
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	IdentityToken string `yaml:"identityToken"`
+	RegistryToken string `yaml:"registryToken"`
+}
+
+// CredentialsStore resolves registry credentials from static entries and
+// Docker credential helpers
+type CredentialsStore struct {
+	static      map[string]Credentials
+	credsStore  string
+	credHelpers map[string]string
+}
+
+// NewCredentialsStore creates an empty credentials store
+func NewCredentialsStore() *CredentialsStore {
+	return &CredentialsStore{
+		static:      map[string]Credentials{},
+		credHelpers: map[string]string{},
+	}
+}
+
+// Lookup returns the credentials for a registry host such as "docker.io" or
+// "registry.internal:5000". Static entries win over credential helpers, which
+// are stopped once ctx is done.
+func (c *CredentialsStore) Lookup(ctx context.Context, registry string) (Credentials, bool, error) {
+	host := normalizeRegistryHost(registry)
+
+	if creds, ok := c.static[host]; ok {
+		return creds, true, nil
+	}
+
+	helper := c.credHelpers[host]
+	if helper == "" {
+		helper = c.credsStore
+	}
+	if helper == "" {
+		return Credentials{}, false, nil
+	}
+
+	return runCredentialHelper(ctx, helper, serverURL(host))
+}
+
+// LoadCredentialsFile adds the registries of a YAML or JSON credentials file:
+//
+//	registries:
+//	  ghcr.io:
+//	    username: user
+//	    password: token
+func (c *CredentialsStore) LoadCredentialsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var file struct {
+		Registries map[string]Credentials `yaml:"registries"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+
+	for registry, creds := range file.Registries {
+		c.static[normalizeRegistryHost(registry)] = creds
+	}
+	return nil
+}
+
+// LoadDockerConfig adds the auths, credsStore and credHelpers of a Docker
+// config.json. Entries already in the store are kept. A missing file is not an error.
+func (c *CredentialsStore) LoadDockerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Docker config: %w", err)
+	}
+
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			Username      string `json:"username"`
+			Password      string `json:"password"`
+			IdentityToken string `json:"identitytoken"`
+			RegistryToken string `json:"registrytoken"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return fmt.Errorf("invalid Docker config %s: %w", path, err)
+	}
+
+	for registry, auth := range dockerConfig.Auths {
+		creds := Credentials{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+			RegistryToken: auth.RegistryToken,
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return fmt.Errorf("invalid auth for %s in Docker config: %w", registry, err)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return fmt.Errorf("invalid auth for %s in Docker config: expected username:password", registry)
+			}
+			creds.Username, creds.Password = username, password
+		}
+		if creds == (Credentials{}) {
+			// Entries without data only mark the registry as managed by a credential helper
+			continue
+		}
+
+		host := normalizeRegistryHost(registry)
+		if _, exists := c.static[host]; !exists {
+			c.static[host] = creds
+		}
+	}
+
+	if c.credsStore == "" {
+		c.credsStore = dockerConfig.CredsStore
+	}
+	for registry, helper := range dockerConfig.CredHelpers {
+		host := normalizeRegistryHost(registry)
+		if _, exists := c.credHelpers[host]; !exists {
+			c.credHelpers[host] = helper
+		}
+	}
+
+	return nil
+}
+
+// normalizeRegistryHost turns a registry key such as "https://index.docker.io/v1/"
+// into a host, mapping Docker Hub aliases to "docker.io"
+func normalizeRegistryHost(registry string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return host
+}
+
+// serverURL returns the server URL a credential helper expects for a registry host
+func serverURL(host string) string {
+	if host == "docker.io" {
+		return dockerHubServerURL
+	}
+	return host
+}
+
+// runCredentialHelper runs "docker-credential-<helper> get" for a server URL,
+// killing it after credentialHelperTimeout or once ctx is done
+func runCredentialHelper(ctx context.Context, helper, server string) (Credentials, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return Credentials{}, false, fmt.Errorf("credential helper %s did not finish: %w", helper, ctx.Err())
+		}
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return Credentials{}, false, nil
+		}
+		return Credentials{}, false, fmt.Errorf("credential helper %s failed: %v: %s", helper, err, output)
+	}
+
+	var result struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return Credentials{}, false, fmt.Errorf("invalid output from credential helper %s: %w", helper, err)
+	}
+
+	// Helpers report identity tokens with the "<token>" username
+	if result.Username == "<token>" {
+		return Credentials{IdentityToken: result.Secret}, true, nil
+	}
+	return Credentials{Username: result.Username, Password: result.Secret}, true, nil
+}
+
+// defaultDockerConfigPath returns $DOCKER_CONFIG/config.json or ~/.docker/config.json
+func defaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), perm))
+	return path
+}
+
+// installCredentialHelper puts a fake docker-credential-<name> script on PATH
+// that prints the given output for any server URL
+func installCredentialHelper(t *testing.T, name, output string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "docker-credential-"+name, "#!/bin/sh\nread server\n"+output+"\n", 0o755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCredentialsStore_LoadCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "credentials.yaml", `
+registries:
+  ghcr.io:
+    username: user
+    password: secret
+  https://registry.internal:5000:
+    registryToken: abc
+`, 0o600)
+
+	store := NewCredentialsStore()
+	require.NoError(t, store.LoadCredentialsFile(path))
+
+	creds, ok, err := store.Lookup(context.Background(), "ghcr.io")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credentials{Username: "user", Password: "secret"}, creds)
+
+	creds, ok, err = store.Lookup(context.Background(), "registry.internal:5000")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "abc", creds.RegistryToken)
+
+	_, ok, err = store.Lookup(context.Background(), "quay.io")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.Error(t, store.LoadCredentialsFile(filepath.Join(dir, "missing.yaml")))
+}
+
+func TestCredentialsStore_LoadDockerConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.json", `{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "aHViLXVzZXI6aHViLXNlY3JldA=="},
+			"quay.io": {"identitytoken": "refresh"},
+			"ghcr.io": {}
+		}
+	}`, 0o600)
+
+	store := NewCredentialsStore()
+	store.static["quay.io"] = Credentials{Username: "file-user"}
+	require.NoError(t, store.LoadDockerConfig(path))
+
+	creds, ok, err := store.Lookup(context.Background(), "docker.io")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credentials{Username: "hub-user", Password: "hub-secret"}, creds)
+
+	// Entries loaded earlier take precedence
+	creds, _, _ = store.Lookup(context.Background(), "quay.io")
+	require.Equal(t, "file-user", creds.Username)
+
+	_, ok, _ = store.Lookup(context.Background(), "ghcr.io")
+	require.False(t, ok)
+
+	// A missing Docker config is not an error
+	require.NoError(t, store.LoadDockerConfig(filepath.Join(dir, "missing.json")))
+
+	invalid := writeFile(t, dir, "invalid.json", `{"auths": {"ghcr.io": {"auth": "bm8tY29sb24="}}}`, 0o600)
+	require.Error(t, NewCredentialsStore().LoadDockerConfig(invalid))
+}
+
+func TestCredentialsStore_CredentialHelpers(t *testing.T) {
+	installCredentialHelper(t, "fake", `echo '{"ServerURL": "'$server'", "Username": "helper-user", "Secret": "'$server'"}'`)
+	installCredentialHelper(t, "token", `echo '{"Username": "<token>", "Secret": "identity"}'`)
+	installCredentialHelper(t, "empty", `echo "credentials not found in native keychain"; exit 1`)
+
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.json", `{
+		"credsStore": "fake",
+		"credHelpers": {"quay.io": "token", "ghcr.io": "empty"}
+	}`, 0o600)
+
+	store := NewCredentialsStore()
+	require.NoError(t, store.LoadDockerConfig(path))
+
+	creds, ok, err := store.Lookup(context.Background(), "docker.io")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credentials{Username: "helper-user", Password: "https://index.docker.io/v1/"}, creds)
+
+	creds, ok, err = store.Lookup(context.Background(), "quay.io")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credentials{IdentityToken: "identity"}, creds)
+
+	_, ok, err = store.Lookup(context.Background(), "ghcr.io")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestCredentialsStore_CredentialHelperCanceled(t *testing.T) {
+	installCredentialHelper(t, "hanging", "exec sleep 10")
+
+	store := NewCredentialsStore()
+	store.credsStore = "hanging"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := store.Lookup(ctx, "docker.io")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestConfig_LoadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		CredentialsFile:  writeFile(t, dir, "credentials.yaml", "registries:\n  ghcr.io:\n    username: file-user\n", 0o600),
+		DockerConfigPath: writeFile(t, dir, "config.json", `{"auths": {"ghcr.io": {"username": "docker-user"}}}`, 0o600),
+	}
+
+	require.NoError(t, cfg.LoadCredentials())
+	creds, ok, err := cfg.Credentials.Lookup(context.Background(), "ghcr.io")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "file-user", creds.Username)
+
+	cfg.CredentialsFile = filepath.Join(dir, "missing.yaml")
+	require.Error(t, cfg.LoadCredentials())
+}
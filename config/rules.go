@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathSegmentRegexp matches one segment of a rule path: a key or "*",
+// optionally followed by list selectors such as "[0]" or "[*]"
+var pathSegmentRegexp = regexp.MustCompile(`^(?:[^\[\]]+)?(?:\[(?:\*|[0-9]+)\])*$`)
+
+// ExtractionRule describes where to find images that the built-in discovery
+// misses. Path selects values with dotted keys, "*" for any key and "[N]" or
+// "[*]" for list items, e.g. "operator.config.defaultImages.*". Regex, when
+// set, pulls images out of the selected strings. Fields maps the image parts
+// (registry, repository, tag, digest, image) to the keys of a selected map,
+// or to named groups of Regex. Rules with a Chart only apply to documents of
+// that chart, not to plain YAML URLs, which have no chart.
+type ExtractionRule struct {
+	Chart  string            `yaml:"chart"`
+	Path   string            `yaml:"path"`
+	Regex  string            `yaml:"regex"`
+	Fields map[string]string `yaml:"fields"`
+
+	// Pattern is the compiled Regex, set by Compile
+	Pattern *regexp.Regexp `yaml:"-"`
+}
+
+// extractionRuleFields are the image parts a rule may map
+var extractionRuleFields = map[string]bool{
+	"image":      true,
+	"registry":   true,
+	"repository": true,
+	"tag":        true,
+	"digest":     true,
+}
+
+// Compile validates the rule and compiles its regex
+func (r *ExtractionRule) Compile() error {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.Path, "$"), ".")
+	if path == "" {
+		return fmt.Errorf("rule has no path")
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" || !pathSegmentRegexp.MatchString(segment) {
+			return fmt.Errorf("invalid path %q", r.Path)
+		}
+	}
+
+	for field := range r.Fields {
+		if !extractionRuleFields[field] {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	if r.Regex != "" {
+		pattern, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		for _, group := range r.Fields {
+			if pattern.SubexpIndex(group) < 0 {
+				return fmt.Errorf("regex has no group %q", group)
+			}
+		}
+		r.Pattern = pattern
+	}
+	return nil
+}
+
+// LoadExtractionRules reads a YAML or JSON rules file:
+//
+//	rules:
+//	  - chart: istio-operator
+//	    path: operator.config.defaultImages.*
+//	  - path: "*.args"
+//	    regex: --sidecar-image=(?P<image>\S+)
+func LoadExtractionRules(path string) ([]ExtractionRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var file struct {
+		Rules []ExtractionRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+
+	for i := range file.Rules {
+		if err := file.Rules[i].Compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d in %s: %w", i+1, path, err)
+		}
+	}
+	return file.Rules, nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExtractionRules(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "rules.yaml", `
+rules:
+  - chart: istio-operator
+    path: operator.config.defaultImages.*
+  - path: $.spec.containers[*].args
+    regex: --sidecar-image=(?P<repo>[^:\s]+):(?P<version>\S+)
+    fields:
+      repository: repo
+      tag: version
+`, 0o600)
+
+	rules, err := LoadExtractionRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, "istio-operator", rules[0].Chart)
+	require.Nil(t, rules[0].Pattern)
+	require.NotNil(t, rules[1].Pattern)
+	require.Equal(t, map[string]string{"repository": "repo", "tag": "version"}, rules[1].Fields)
+
+	_, err = LoadExtractionRules(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestExtractionRule_Compile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ExtractionRule
+		err  string
+	}{
+		{"no path", ExtractionRule{}, "rule has no path"},
+		{"empty segment", ExtractionRule{Path: "a..b"}, "invalid path"},
+		{"invalid selector", ExtractionRule{Path: "containers[x]"}, "invalid path"},
+		{"invalid regex", ExtractionRule{Path: "args", Regex: "("}, "invalid regex"},
+		{"unknown field", ExtractionRule{Path: "a", Fields: map[string]string{"version": "tag"}}, "unknown field"},
+		{"missing group", ExtractionRule{Path: "args", Regex: "(?P<image>.+)", Fields: map[string]string{"tag": "version"}}, "regex has no group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.rule.Compile(), tt.err)
+		})
+	}
+}
+
+func TestConfig_LoadExtractionRules(t *testing.T) {
+	t.Setenv("EXTRACTION_RULES_FILE", "")
+	cfg := NewConfig()
+	require.NoError(t, cfg.LoadExtractionRules())
+	require.Empty(t, cfg.ExtractionRules)
+
+	dir := t.TempDir()
+	cfg.RulesFile = writeFile(t, dir, "rules.yaml", "rules:\n  - path: \"a[0\"\n", 0o600)
+	require.ErrorContains(t, cfg.LoadExtractionRules(), "invalid rule 1")
+}
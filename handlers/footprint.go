@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"sort"
+
+	"helm-viewer/models"
+)
+
+// workloadKey identifies a workload across namespaces
+type workloadKey struct {
+	namespace string
+	workload  string
+}
+
+// estimateFootprint estimates the image data the workloads of a chart bring
+// onto a cluster of nodes from the sizes of its unique images; images that
+// failed to be looked up are counted as missing, and images only referenced
+// by manifests without a pod spec are left out
+func estimateFootprint(images []models.ContainerImage, metadata []models.ImageMetadata, errs []error, nodes int) models.Footprint {
+	if nodes < 1 {
+		nodes = 1
+	}
+	footprint := models.Footprint{Nodes: nodes}
+
+	workloads := map[workloadKey]*models.WorkloadFootprint{}
+	var order []workloadKey
+	for i, image := range images {
+		if errs[i] != nil {
+			footprint.Missing++
+			continue
+		}
+		bytes := metadata[i].Bytes
+
+		// Count the pods running the image, once per workload
+		pods := 0
+		counted := map[workloadKey]bool{}
+		for _, occurrence := range image.Occurrences {
+			if occurrence.Workload == "" {
+				// Manifests without a pod spec, such as ConfigMaps, run no
+				// image; images outside manifests, such as in values files,
+				// run once
+				if occurrence.Resource == nil {
+					pods++
+				}
+				continue
+			}
+
+			key := workloadKey{workload: occurrence.Workload}
+			if occurrence.Resource != nil {
+				key.namespace = occurrence.Resource.Namespace
+			}
+			workloadPods := occurrencePods(occurrence, nodes)
+			w, ok := workloads[key]
+			if !ok {
+				w = &models.WorkloadFootprint{Workload: key.workload, Namespace: key.namespace, Pods: workloadPods}
+				workloads[key] = w
+				order = append(order, key)
+			}
+			if !counted[key] {
+				counted[key] = true
+				pods += workloadPods
+				w.Bytes += bytes
+				w.PullBytes += bytes * int64(minInt(w.Pods, nodes))
+			}
+		}
+
+		if pods > 0 {
+			footprint.NodeBytes += bytes
+			footprint.PullBytes += bytes * int64(minInt(pods, nodes))
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].namespace != order[j].namespace {
+			return order[i].namespace < order[j].namespace
+		}
+		return order[i].workload < order[j].workload
+	})
+	for _, key := range order {
+		footprint.Workloads = append(footprint.Workloads, *workloads[key])
+	}
+	return footprint
+}
+
+// occurrencePods returns the pod count of the workload of an occurrence:
+// every node for DaemonSets, its replicas otherwise
+func occurrencePods(occurrence models.ImageOccurrence, nodes int) int {
+	switch {
+	case occurrence.Resource != nil && occurrence.Resource.Kind == "DaemonSet":
+		return nodes
+	case occurrence.Replicas != nil:
+		return *occurrence.Replicas
+	}
+	return 1
+}
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replicas(n int) *int {
+	return &n
+}
+
+func TestEstimateFootprint(t *testing.T) {
+	const mb = 1024 * 1024
+	web := &models.Resource{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "prod", Name: "web"}
+	agent := &models.Resource{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "agent"}
+	images := []models.ContainerImage{
+		{Name: "nginx:1.25", Occurrences: []models.ImageOccurrence{
+			{Workload: "Deployment/web", Resource: web, Replicas: replicas(3)},
+			{Workload: "Deployment/web", Resource: web, Replicas: replicas(3), Role: models.ContainerRoleInit},
+		}},
+		{Name: "busybox:1.36", Occurrences: []models.ImageOccurrence{
+			{Workload: "Deployment/web", Resource: web, Replicas: replicas(3)},
+			{Workload: "DaemonSet/agent", Resource: agent},
+		}},
+		{Name: "fluentd:1.16", Occurrences: []models.ImageOccurrence{{Workload: "DaemonSet/agent", Resource: agent}}},
+		{Name: "redis:7.2", Occurrences: []models.ImageOccurrence{{Source: "values.yaml"}}},
+		{Name: "idle:1.0", Occurrences: []models.ImageOccurrence{{Workload: "Deployment/idle", Replicas: replicas(0)}}},
+		{Name: "migrate:2.0", Occurrences: []models.ImageOccurrence{{Resource: &models.Resource{APIVersion: "v1", Kind: "ConfigMap", Name: "settings"}}}},
+		{Name: "private/app:1.0", Occurrences: []models.ImageOccurrence{{Workload: "Deployment/web", Resource: web, Replicas: replicas(3)}}},
+	}
+	metadata := []models.ImageMetadata{{Bytes: 50 * mb}, {Bytes: 2 * mb}, {Bytes: 100 * mb}, {Bytes: 40 * mb}, {Bytes: 10 * mb}, {Bytes: 30 * mb}, {}}
+	errs := []error{nil, nil, nil, nil, nil, nil, assert.AnError}
+
+	footprint := estimateFootprint(images, metadata, errs, 5)
+	require.Equal(t, 5, footprint.Nodes)
+	require.Equal(t, 1, footprint.Missing)
+	// Every running image on one node; idle:1.0 has no pods and migrate:2.0
+	// is only set in a ConfigMap
+	require.Equal(t, int64(192*mb), footprint.NodeBytes)
+	// nginx on 3 nodes, busybox on 5 (3 + 5 pods), fluentd on 5, redis once
+	require.Equal(t, int64((150+10+500+40)*mb), footprint.PullBytes)
+	require.Equal(t, []models.WorkloadFootprint{
+		{Workload: "DaemonSet/agent", Pods: 5, Bytes: 102 * mb, PullBytes: 510 * mb},
+		{Workload: "Deployment/idle", Pods: 0, Bytes: 10 * mb, PullBytes: 0},
+		{Workload: "Deployment/web", Namespace: "prod", Pods: 3, Bytes: 52 * mb, PullBytes: 156 * mb},
+	}, footprint.Workloads)
+
+	// Without a node count, the footprint is estimated for a single node
+	footprint = estimateFootprint(images, metadata, errs, 0)
+	require.Equal(t, 1, footprint.Nodes)
+	require.Equal(t, int64(192*mb), footprint.PullBytes)
+}
+
+func TestLoadHELM_Footprint(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	doc := models.YAMLDocument{Source: "templates/deployment.yaml"}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+		{Name: "nginx:1.25", Registry: "docker.io", Workload: "Deployment/web", Replicas: replicas(4)},
+	})
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "1.00 KB", Bytes: 1024, Layers: 1}, nil)
+	mockService.On("RegistryStats", []string{"docker.io"}).Return(nil)
+
+	jsonBody, _ := json.Marshal(models.HELMRequest{URL: "http://example.com/chart.tgz", Nodes: 3})
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, models.Footprint{
+		Nodes:     3,
+		NodeBytes: 1024,
+		PullBytes: 3 * 1024,
+		Workloads: []models.WorkloadFootprint{{Workload: "Deployment/web", Pods: 4, Bytes: 1024, PullBytes: 3 * 1024}},
+	}, response.Footprint)
+	require.Equal(t, 4, *response.Images[0].Occurrences[0].Replicas)
+
+	// Node counts below 1 are rejected
+	jsonBody, _ = json.Marshal(map[string]any{"url": "http://example.com/chart.tgz", "nodes": -1})
+	req = httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
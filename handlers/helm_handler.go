@@ -1,33 +1,84 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"helm-viewer/config"
 	"helm-viewer/models"
+	"helm-viewer/reference"
 
 	"github.com/gin-gonic/gin"
 )
 
-// HELMService defines the interface for HELM operations
+// HELMService defines the interface for HELM operations. Methods that reach
+// upstream servers stop when their context is done.
 type HELMService interface {
-	LoadAndParseYAML(url string) (any, error)
-	FindContainerImages(yamlContent any) []models.ContainerImage
-	GetImageInfo(imageName string) (string, int, error)
+	LoadAndParseYAML(ctx context.Context, url string, opts models.LoadOptions) ([]models.YAMLDocument, error)
+	FindDocumentImages(doc models.YAMLDocument) []models.ContainerImage
+	GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error)
+	ListRepoCharts(ctx context.Context, repoURL string) ([]models.RepoChart, error)
+	ResolveChartURL(ctx context.Context, repoURL, name, version string) (string, error)
+	CacheStats() models.CacheStats
+	RegistryStats(registries ...string) []models.RegistryStats
+	RegistryQuotas() []models.RegistryQuota
 }
 
 // HELMHandler handles requests related to YAML documents
 type HELMHandler struct {
-	helmService HELMService
+	helmService       HELMService
+	lookupConcurrency int
+	requestTimeout    time.Duration
 }
 
 // NewHELMHandler creates a new instance of HELMHandler
 func NewHELMHandler(helmService HELMService) *HELMHandler {
 	return &HELMHandler{
-		helmService: helmService,
+		helmService:       helmService,
+		lookupConcurrency: config.DefaultLookupConcurrency,
+		requestTimeout:    config.DefaultRequestTimeout,
 	}
 }
 
+// SetLookupConcurrency sets the number of images looked up at a time for one
+// request
+func (h *HELMHandler) SetLookupConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	h.lookupConcurrency = n
+}
+
+// SetRequestTimeout sets the time budget of one request, shared by all the
+// upstream calls it makes
+func (h *HELMHandler) SetRequestTimeout(timeout time.Duration) {
+	h.requestTimeout = timeout
+}
+
+// requestContext returns the context of a request, canceled when the client
+// goes away or the request timeout runs out
+func (h *HELMHandler) requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), h.requestTimeout)
+}
+
+// chartURL returns the URL to load for a request; the version of oci:// charts
+// becomes the tag, with "+" stored as "_" as Helm does for OCI tags. URLs
+// that already have a tag or digest cannot take a version.
+func chartURL(request models.HELMRequest) (string, error) {
+	if request.Version == "" || !strings.HasPrefix(request.URL, "oci://") {
+		return request.URL, nil
+	}
+	if name := request.URL[strings.LastIndex(request.URL, "/")+1:]; strings.ContainsAny(name, ":@") {
+		return "", fmt.Errorf("chart %s already has a tag or digest, version %s cannot be applied", request.URL, request.Version)
+	}
+	return request.URL + ":" + strings.ReplaceAll(request.Version, "+", "_"), nil
+}
+
 // LoadHELM handles the request to load a YAML document from URL
 func (h *HELMHandler) LoadHELM(c *gin.Context) {
 	var request models.HELMRequest
@@ -39,8 +90,95 @@ func (h *HELMHandler) LoadHELM(c *gin.Context) {
 		return
 	}
 
+	url, err := chartURL(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.HELMResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	h.loadChart(ctx, c, url, request.LoadOptions, request.Strict, request.Nodes)
+}
+
+// chartImages are the unique images found in a chart, with their metadata
+// and lookup errors in the same order; failed is the index of the image whose
+// lookup failed a strict scan, -1 otherwise
+type chartImages struct {
+	images   []models.ContainerImage
+	metadata []models.ImageMetadata
+	errs     []error
+	failed   int
+}
+
+// scanChart loads a chart or YAML document from URL and looks up each unique
+// container image found in it once; with strict set, the first failed lookup
+// stops the others
+func (h *HELMHandler) scanChart(ctx context.Context, url string, opts models.LoadOptions, lookup models.LookupOptions, strict bool) (chartImages, error) {
 	// Load and parse YAML
-	yamlContent, err := h.helmService.LoadAndParseYAML(request.URL)
+	docs, err := h.helmService.LoadAndParseYAML(ctx, url, opts)
+	if err != nil {
+		return chartImages{}, err
+	}
+
+	// Find container images, recording the file each one came from
+	var images []models.ContainerImage
+	for _, doc := range docs {
+		images = append(images, h.helmService.FindDocumentImages(doc)...)
+	}
+
+	images = uniqueImages(images)
+	metadata, errs, failed := h.lookupImages(ctx, images, lookup, strict)
+	return chartImages{images: images, metadata: metadata, errs: errs, failed: failed}, nil
+}
+
+// summarize sets the lookup status of the images and counts them. The image
+// that failed a strict scan is returned as an error instead.
+func (scan chartImages) summarize() (models.ImagesSummary, error) {
+	if scan.failed >= 0 {
+		return models.ImagesSummary{}, fmt.Errorf("Failed to get size for image %s: %v", scan.images[scan.failed].Name, scan.errs[scan.failed])
+	}
+
+	summary := models.ImagesSummary{Total: len(scan.images)}
+	for i, err := range scan.errs {
+		if err == nil {
+			scan.images[i].Status = models.ImageStatusOK
+			summary.OK++
+			if len(scan.metadata[i].MissingPlatforms) > 0 {
+				summary.MissingPlatforms++
+			}
+			continue
+		}
+		scan.images[i].Status = models.ImageStatusError
+		scan.images[i].Error = imageError(err)
+		summary.Failed++
+		if summary.Errors == nil {
+			summary.Errors = map[string]int{}
+		}
+		summary.Errors[scan.images[i].Error.Code]++
+	}
+	return summary, nil
+}
+
+// loadChart loads a chart or YAML document from URL and responds with the
+// container images found in it. Images that cannot be looked up are reported
+// with their error, unless strict is set, in which case the first one fails
+// the request. The image footprint is estimated for a cluster of nodes.
+func (h *HELMHandler) loadChart(ctx context.Context, c *gin.Context, url string, opts models.LoadOptions, strict bool, nodes int) {
+	scan, err := h.scanChart(ctx, url, opts, models.LookupOptions{}, strict)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.HELMResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	summary, err := scan.summarize()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.HELMResponse{
 			Success: false,
@@ -49,25 +187,126 @@ func (h *HELMHandler) LoadHELM(c *gin.Context) {
 		return
 	}
 
-	// Find container images
-	images := h.helmService.FindContainerImages(yamlContent)
+	c.JSON(http.StatusOK, models.ImagesResponse{
+		Success:    true,
+		Images:     scan.images,
+		Summary:    summary,
+		Footprint:  estimateFootprint(scan.images, scan.metadata, scan.errs, nodes),
+		Registries: h.registryStats(scan.images),
+	})
+}
+
+// registryStats returns the circuit breaker state of the registries of images
+func (h *HELMHandler) registryStats(images []models.ContainerImage) []models.RegistryStats {
+	var registries []string
+	seen := map[string]bool{}
+	for _, image := range images {
+		if image.Registry != "" && !seen[image.Registry] {
+			seen[image.Registry] = true
+			registries = append(registries, image.Registry)
+		}
+	}
+	if len(registries) == 0 {
+		return nil
+	}
+	return h.helmService.RegistryStats(registries...)
+}
+
+// imageError returns the structured error of a failed image lookup
+func imageError(err error) *models.ImageError {
+	var imageErr *models.ImageError
+	if errors.As(err, &imageErr) {
+		return imageErr
+	}
+	return &models.ImageError{Code: models.ImageErrorUnknown, Message: err.Error()}
+}
+
+// lookupImages fills in the size and layer count of images with a bounded
+// pool of workers; metadata and errors keep the order of images. With strict
+// set, the first failed lookup cancels the others and skips the images not
+// looked up yet; its index is returned, -1 when every lookup succeeded.
+func (h *HELMHandler) lookupImages(ctx context.Context, images []models.ContainerImage, lookup models.LookupOptions, strict bool) ([]models.ImageMetadata, []error, int) {
+	metadata := make([]models.ImageMetadata, len(images))
+	errs := make([]error, len(images))
+	indexes := make(chan int)
 
-	// Get size for each image
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failed := -1
+	var fail sync.Once
+
+	workers := h.lookupConcurrency
+	if workers > len(images) {
+		workers = len(images)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				metadata[i], errs[i] = h.helmService.GetImageMetadata(ctx, images[i].Name, lookup)
+				images[i].Size, images[i].Layers = metadata[i].Size, metadata[i].Layers
+				if strict && errs[i] != nil {
+					i := i
+					fail.Do(func() {
+						failed = i
+						cancel()
+					})
+				}
+			}
+		}()
+	}
 	for i := range images {
-		size, layers, err := h.helmService.GetImageInfo(images[i].Name)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.HELMResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to get size for image %s: %v", images[i].Name, err),
-			})
-			return
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return metadata, errs, failed
+}
+
+// uniqueImages merges the images with the same normalized reference into one
+// entry, keeping the fields of the first one and listing every place they
+// were found in as occurrences
+func uniqueImages(images []models.ContainerImage) []models.ContainerImage {
+	unique := []models.ContainerImage{}
+	index := map[string]int{}
+
+	for _, image := range images {
+		key := image.Name
+		if ref, err := reference.Parse(image.Name); err == nil {
+			key = ref.String()
+		}
+
+		occurrence := models.ImageOccurrence{
+			Source:     image.Source,
+			Path:       image.Path,
+			Line:       image.Line,
+			Column:     image.Column,
+			Set:        image.Set,
+			Container:  image.Container,
+			Role:       image.Role,
+			PullPolicy: image.PullPolicy,
+			Workload:   image.Workload,
+			Replicas:   image.Replicas,
+			Resource:   image.Resource,
 		}
-		images[i].Size = size
-		images[i].Layers = layers
+		if i, ok := index[key]; ok {
+			unique[i].Occurrences = append(unique[i].Occurrences, occurrence)
+			continue
+		}
+
+		image.Reference = key
+		image.Occurrences = []models.ImageOccurrence{occurrence}
+		index[key] = len(unique)
+		unique = append(unique, image)
 	}
 
-	c.JSON(http.StatusOK, models.ImagesResponse{
-		Success: true,
-		Images:  images,
-	})
+	return unique
 }
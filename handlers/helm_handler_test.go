@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"helm-viewer/models"
 
@@ -15,24 +17,54 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// MockHELMService is a mock implementation of HELMServiceInterface
+// MockHELMService is a mock implementation of HELMServiceInterface; contexts
+// are not part of the expectations
 type MockHELMService struct {
 	mock.Mock
 }
 
-func (m *MockHELMService) LoadAndParseYAML(url string) (interface{}, error) {
-	args := m.Called(url)
-	return args.Get(0), args.Error(1)
+func (m *MockHELMService) LoadAndParseYAML(ctx context.Context, url string, opts models.LoadOptions) ([]models.YAMLDocument, error) {
+	args := m.Called(url, opts)
+	docs, _ := args.Get(0).([]models.YAMLDocument)
+	return docs, args.Error(1)
 }
 
-func (m *MockHELMService) FindContainerImages(content interface{}) []models.ContainerImage {
-	args := m.Called(content)
+func (m *MockHELMService) FindDocumentImages(doc models.YAMLDocument) []models.ContainerImage {
+	args := m.Called(doc)
 	return args.Get(0).([]models.ContainerImage)
 }
 
-func (m *MockHELMService) GetImageInfo(imageName string) (string, int, error) {
+func (m *MockHELMService) GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
 	args := m.Called(imageName)
-	return args.String(0), args.Int(1), args.Error(2)
+	return args.Get(0).(models.ImageMetadata), args.Error(1)
+}
+
+func (m *MockHELMService) ListRepoCharts(ctx context.Context, repoURL string) ([]models.RepoChart, error) {
+	args := m.Called(repoURL)
+	charts, _ := args.Get(0).([]models.RepoChart)
+	return charts, args.Error(1)
+}
+
+func (m *MockHELMService) ResolveChartURL(ctx context.Context, repoURL, name, version string) (string, error) {
+	args := m.Called(repoURL, name, version)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockHELMService) CacheStats() models.CacheStats {
+	args := m.Called()
+	return args.Get(0).(models.CacheStats)
+}
+
+func (m *MockHELMService) RegistryStats(registries ...string) []models.RegistryStats {
+	args := m.Called(registries)
+	stats, _ := args.Get(0).([]models.RegistryStats)
+	return stats
+}
+
+func (m *MockHELMService) RegistryQuotas() []models.RegistryQuota {
+	args := m.Called()
+	quotas, _ := args.Get(0).([]models.RegistryQuota)
+	return quotas
 }
 
 func (m *MockHELMService) SetDockerHubBaseURL(url string) {
@@ -43,6 +75,12 @@ func setupTestRouter(handler *HELMHandler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.POST("/load-helm", handler.LoadHELM)
+	router.POST("/v2/load-helm", handler.LoadHELMV2)
+	router.POST("/repo-charts", handler.ListRepoCharts)
+	router.POST("/repo-scan", handler.ScanRepoChart)
+	router.GET("/cache-stats", handler.GetCacheStats)
+	router.GET("/registry-stats", handler.GetRegistryStats)
+	router.GET("/registry-quotas", handler.GetRegistryQuotas)
 	return router
 }
 
@@ -64,13 +102,15 @@ func TestLoadHELM_Success(t *testing.T) {
 		{
 			Name:      "nginx:latest",
 			Container: "",
+			Source:    "chart.yaml",
 		},
 	}
 
 	// Setup expectations
-	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml").Return(yamlContent, nil)
-	mockService.On("FindContainerImages", yamlContent).Return(images)
-	mockService.On("GetImageInfo", "nginx:latest").Return("100MB", 5, nil)
+	doc := models.YAMLDocument{Source: "chart.yaml", Content: yamlContent}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return(images)
+	mockService.On("GetImageMetadata", "nginx:latest").Return(models.ImageMetadata{Size: "100MB", Layers: 5}, nil)
 
 	// Create request
 	reqBody := models.HELMRequest{URL: "http://example.com/chart.yaml"}
@@ -93,10 +133,231 @@ func TestLoadHELM_Success(t *testing.T) {
 	require.Equal(t, "nginx:latest", response.Images[0].Name)
 	require.Equal(t, "100MB", response.Images[0].Size)
 	require.Equal(t, 5, response.Images[0].Layers)
+	require.Equal(t, "chart.yaml", response.Images[0].Source)
 
 	mockService.AssertExpectations(t)
 }
 
+func TestLoadHELM_LoadOptions(t *testing.T) {
+	mockService := new(MockHELMService)
+	handler := NewHELMHandler(mockService)
+	router := setupTestRouter(handler)
+
+	opts := models.LoadOptions{
+		Render:      true,
+		ValuesFiles: []string{"http://example.com/prod.yaml"},
+		Values:      map[string]any{"image": map[string]any{"tag": "1.26"}},
+		Set:         []string{"replicas=3"},
+	}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", opts).Return([]models.YAMLDocument{}, nil)
+
+	body := `{"url": "http://example.com/chart.tgz", "render": true, "valuesFiles": ["http://example.com/prod.yaml"], "values": {"image": {"tag": "1.26"}}, "set": ["replicas=3"]}`
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestLoadHELM_DeduplicatesImages(t *testing.T) {
+	mockService := new(MockHELMService)
+	handler := NewHELMHandler(mockService)
+	router := setupTestRouter(handler)
+
+	values := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+	manifest := models.YAMLDocument{Source: "templates/deployment.yaml", Content: map[string]interface{}{"kind": "Deployment"}}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{values, manifest}, nil)
+	mockService.On("FindDocumentImages", values).Return([]models.ContainerImage{
+		{Name: "nginx:1.25", Source: "values.yaml", Path: "image", Set: "image=nginx:1.25"},
+		{Name: "redis:7.2", Source: "values.yaml", Path: "cache.image"},
+	})
+	mockService.On("FindDocumentImages", manifest).Return([]models.ContainerImage{
+		{Name: "docker.io/library/nginx:1.25", Source: "templates/deployment.yaml", Container: "web", Workload: "Deployment/web"},
+	})
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil).Once()
+	mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{Size: "40.00 MB", Layers: 4}, nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Images, 2)
+	require.Equal(t, "docker.io/library/nginx:1.25", response.Images[0].Reference)
+	require.Equal(t, []models.ImageOccurrence{
+		{Source: "values.yaml", Path: "image", Set: "image=nginx:1.25"},
+		{Source: "templates/deployment.yaml", Container: "web", Workload: "Deployment/web"},
+	}, response.Images[0].Occurrences)
+	require.Equal(t, "docker.io/library/redis:7.2", response.Images[1].Reference)
+	require.Len(t, response.Images[1].Occurrences, 1)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestLoadHELM_ConcurrentLookups(t *testing.T) {
+	mockService := new(MockHELMService)
+	handler := NewHELMHandler(mockService)
+	handler.SetLookupConcurrency(3)
+	router := setupTestRouter(handler)
+
+	doc := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+		{Name: "nginx:1.25"}, {Name: "redis:7.2"}, {Name: "postgres:16"},
+	})
+	// The first image answers last; the response keeps the discovery order
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil).After(50 * time.Millisecond)
+	mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{Size: "40.00 MB", Layers: 4}, nil)
+	mockService.On("GetImageMetadata", "postgres:16").Return(models.ImageMetadata{Size: "150.00 MB", Layers: 12}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Images, 3)
+	require.Equal(t, "nginx:1.25", response.Images[0].Name)
+	require.Equal(t, "50.00 MB", response.Images[0].Size)
+	require.Equal(t, "redis:7.2", response.Images[1].Name)
+	require.Equal(t, 4, response.Images[1].Layers)
+	require.Equal(t, "postgres:16", response.Images[2].Name)
+	require.Equal(t, "150.00 MB", response.Images[2].Size)
+
+	mockService.AssertExpectations(t)
+}
+
+// strictService fails lookups through its mock, except for slowImage, whose
+// lookup waits for its context to be done and reports why it ended
+type strictService struct {
+	*MockHELMService
+	slowImage string
+	ended     chan error
+}
+
+func (s strictService) GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	if imageName != s.slowImage {
+		return s.MockHELMService.GetImageMetadata(ctx, imageName, opts)
+	}
+	<-ctx.Done()
+	s.ended <- ctx.Err()
+	return models.ImageMetadata{}, ctx.Err()
+}
+
+func TestLoadHELM_StrictReportsFirstError(t *testing.T) {
+	doc := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+	request := func(router *gin.Engine) models.HELMResponse {
+		req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz", "strict": true}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		var response models.HELMResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("running lookups are canceled", func(t *testing.T) {
+		mockService := new(MockHELMService)
+		service := strictService{MockHELMService: mockService, slowImage: "postgres:16", ended: make(chan error, 1)}
+		handler := NewHELMHandler(service)
+		handler.SetRequestTimeout(10 * time.Second)
+
+		mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+		mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+			{Name: "nginx:1.25"}, {Name: "postgres:16"}, {Name: "redis:7.2"},
+		})
+		mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+		mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{}, assert.AnError)
+
+		response := request(setupTestRouter(handler))
+		require.Contains(t, response.Error, "Failed to get size for image redis:7.2")
+		require.ErrorIs(t, <-service.ended, context.Canceled)
+	})
+
+	t.Run("queued lookups are skipped", func(t *testing.T) {
+		mockService := new(MockHELMService)
+		handler := NewHELMHandler(mockService)
+		handler.SetLookupConcurrency(1)
+
+		mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+		mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+			{Name: "nginx:1.25"}, {Name: "redis:7.2"}, {Name: "postgres:16"},
+		})
+		mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+		mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{}, assert.AnError)
+
+		response := request(setupTestRouter(handler))
+		require.Contains(t, response.Error, "Failed to get size for image redis:7.2")
+		mockService.AssertNotCalled(t, "GetImageMetadata", "postgres:16")
+	})
+}
+
+// blockingService waits for the request context to be done before failing
+// chart loads, and records the deadline of image lookups
+type blockingService struct {
+	*MockHELMService
+	deadlines chan bool
+}
+
+func (s blockingService) LoadAndParseYAML(ctx context.Context, url string, opts models.LoadOptions) ([]models.YAMLDocument, error) {
+	if url != "http://example.com/slow.tgz" {
+		return s.MockHELMService.LoadAndParseYAML(ctx, url, opts)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s blockingService) GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	_, ok := ctx.Deadline()
+	s.deadlines <- ok
+	return s.MockHELMService.GetImageMetadata(ctx, imageName, opts)
+}
+
+func TestLoadHELM_RequestTimeout(t *testing.T) {
+	mockService := new(MockHELMService)
+	service := blockingService{MockHELMService: mockService, deadlines: make(chan bool, 1)}
+	handler := NewHELMHandler(service)
+	handler.SetRequestTimeout(50 * time.Millisecond)
+	router := setupTestRouter(handler)
+
+	t.Run("deadline reaches image lookups", func(t *testing.T) {
+		doc := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+		mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+		mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{{Name: "nginx:1.25"}})
+		mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.True(t, <-service.deadlines)
+	})
+
+	t.Run("slow load is canceled", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/slow.tgz"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.Contains(t, w.Body.String(), context.DeadlineExceeded.Error())
+	})
+}
+
 func TestLoadHELM_InvalidRequest(t *testing.T) {
 	// Setup
 	mockService := new(MockHELMService)
@@ -128,7 +389,7 @@ func TestLoadHELM_YAMLLoadError(t *testing.T) {
 	router := setupTestRouter(handler)
 
 	// Setup expectations
-	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml").Return(nil, assert.AnError)
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml", models.LoadOptions{}).Return(nil, assert.AnError)
 
 	// Create request
 	reqBody := models.HELMRequest{URL: "http://example.com/chart.yaml"}
@@ -172,12 +433,13 @@ func TestLoadHELM_ImageInfoError(t *testing.T) {
 	}
 
 	// Setup expectations
-	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml").Return(yamlContent, nil)
-	mockService.On("FindContainerImages", yamlContent).Return(images)
-	mockService.On("GetImageInfo", "nginx:latest").Return("", 0, assert.AnError)
+	doc := models.YAMLDocument{Source: "chart.yaml", Content: yamlContent}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.yaml", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return(images)
+	mockService.On("GetImageMetadata", "nginx:latest").Return(models.ImageMetadata{}, assert.AnError)
 
 	// Create request
-	reqBody := models.HELMRequest{URL: "http://example.com/chart.yaml"}
+	reqBody := models.HELMRequest{URL: "http://example.com/chart.yaml", Strict: true}
 	jsonBody, _ := json.Marshal(reqBody)
 	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBuffer(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
@@ -195,3 +457,112 @@ func TestLoadHELM_ImageInfoError(t *testing.T) {
 	require.False(t, response.Success)
 	require.Contains(t, response.Error, "Failed to get size for image nginx:latest")
 }
+
+func TestLoadHELM_PartialResults(t *testing.T) {
+	mockService := new(MockHELMService)
+	handler := NewHELMHandler(mockService)
+	router := setupTestRouter(handler)
+
+	doc := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+		{Name: "nginx:1.25"}, {Name: "private/app:1.0"}, {Name: "nginx:0.0"}, {Name: "redis:7.2"},
+	})
+	notFound := &models.ImageError{Code: models.ImageErrorNotFound, Message: "error getting manifest 0.0: 404 Not Found"}
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+	mockService.On("GetImageMetadata", "private/app:1.0").Return(models.ImageMetadata{}, &models.ImageError{Code: models.ImageErrorUnauthorized, Message: "registry requires credentials"})
+	mockService.On("GetImageMetadata", "nginx:0.0").Return(models.ImageMetadata{}, notFound)
+	mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{}, assert.AnError)
+
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Len(t, response.Images, 4)
+
+	require.Equal(t, models.ImageStatusOK, response.Images[0].Status)
+	require.Equal(t, "50.00 MB", response.Images[0].Size)
+	require.Nil(t, response.Images[0].Error)
+
+	require.Equal(t, models.ImageStatusError, response.Images[1].Status)
+	require.Equal(t, models.ImageErrorUnauthorized, response.Images[1].Error.Code)
+	require.Equal(t, notFound, response.Images[2].Error)
+	require.Equal(t, &models.ImageError{Code: models.ImageErrorUnknown, Message: assert.AnError.Error()}, response.Images[3].Error)
+
+	require.Equal(t, models.ImagesSummary{
+		Total:  4,
+		OK:     1,
+		Failed: 3,
+		Errors: map[string]int{
+			models.ImageErrorUnauthorized: 1,
+			models.ImageErrorNotFound:     1,
+			models.ImageErrorUnknown:      1,
+		},
+	}, response.Summary)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestLoadHELM_RegistryStats(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	doc := models.YAMLDocument{Source: "values.yaml", Content: map[string]interface{}{}}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+		{Name: "ghcr.io/org/app:1.0", Registry: "ghcr.io"},
+		{Name: "nginx:1.25", Registry: "docker.io"},
+		{Name: "ghcr.io/org/worker:1.0", Registry: "ghcr.io"},
+	})
+	unavailable := &models.ImageError{Code: models.ImageErrorCircuitOpen, Message: "registry ghcr.io is unavailable"}
+	mockService.On("GetImageMetadata", "ghcr.io/org/app:1.0").Return(models.ImageMetadata{}, unavailable)
+	mockService.On("GetImageMetadata", "ghcr.io/org/worker:1.0").Return(models.ImageMetadata{}, unavailable)
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+	stats := []models.RegistryStats{
+		{Registry: "docker.io", Circuit: "closed", Requests: 1},
+		{Registry: "ghcr.io", Circuit: "open", Requests: 5, Errors: 5, Trips: 1},
+	}
+	mockService.On("RegistryStats", []string{"ghcr.io", "docker.io"}).Return(stats)
+
+	req := httptest.NewRequest(http.MethodPost, "/load-helm", bytes.NewBufferString(`{"url": "http://example.com/chart.tgz"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, stats, response.Registries)
+	require.Equal(t, map[string]int{models.ImageErrorCircuitOpen: 2}, response.Summary.Errors)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestChartURL(t *testing.T) {
+	for _, tc := range []struct {
+		request models.HELMRequest
+		url     string
+	}{
+		{models.HELMRequest{URL: "https://example.com/values.yaml", Version: "1.0.0"}, "https://example.com/values.yaml"},
+		{models.HELMRequest{URL: "oci://ghcr.io/org/chart"}, "oci://ghcr.io/org/chart"},
+		{models.HELMRequest{URL: "oci://ghcr.io/org/chart:1.2.3"}, "oci://ghcr.io/org/chart:1.2.3"},
+		{models.HELMRequest{URL: "oci://ghcr.io/org/chart", Version: "1.2.3+build.1"}, "oci://ghcr.io/org/chart:1.2.3_build.1"},
+		{models.HELMRequest{URL: "oci://localhost:5000/chart", Version: "1.2.3"}, "oci://localhost:5000/chart:1.2.3"},
+	} {
+		url, err := chartURL(tc.request)
+		require.NoError(t, err)
+		require.Equal(t, tc.url, url)
+	}
+
+	for _, url := range []string{"oci://ghcr.io/org/chart:1.2.3", "oci://ghcr.io/org/chart@sha256:abc"} {
+		_, err := chartURL(models.HELMRequest{URL: url, Version: "1.2.3"})
+		require.ErrorContains(t, err, "already has a tag or digest")
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"helm-viewer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadHELMV2 handles the request to load a YAML document from URL, answering
+// with the v2 response schema: sizes in bytes, digests, media types, platform,
+// timestamps and totals
+func (h *HELMHandler) LoadHELMV2(c *gin.Context) {
+	var request models.HELMRequestV2
+	if err := c.ShouldBindJSON(&request); err != nil || !validPlatforms(request.Platforms) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseV2{
+			APIVersion: models.APIVersionV2,
+			Error:      "Invalid request format",
+		})
+		return
+	}
+
+	url, err := chartURL(request.HELMRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseV2{
+			APIVersion: models.APIVersionV2,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	lookup := models.LookupOptions{Details: true, Uncompressed: request.Uncompressed, Platforms: request.Platforms}
+	scan, err := h.scanChart(ctx, url, request.LoadOptions, lookup, request.Strict)
+	var summary models.ImagesSummary
+	if err == nil {
+		summary, err = scan.summarize()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponseV2{
+			APIVersion: models.APIVersionV2,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ImagesResponseV2{
+		APIVersion: models.APIVersionV2,
+		Success:    true,
+		Images:     imagesV2(scan),
+		Summary:    summary,
+		Totals:     imageTotals(scan),
+		Footprint:  estimateFootprint(scan.images, scan.metadata, scan.errs, request.Nodes),
+		Registries: h.registryStats(scan.images),
+	})
+}
+
+// imagesV2 converts the images of a scan to the v2 schema
+func imagesV2(scan chartImages) []models.ImageV2 {
+	images := make([]models.ImageV2, 0, len(scan.images))
+	for i, image := range scan.images {
+		v2 := models.ImageV2{
+			Name:        image.Name,
+			Reference:   image.Reference,
+			Registry:    image.Registry,
+			Namespace:   image.Namespace,
+			Repository:  image.Repository,
+			Tag:         image.Tag,
+			Digest:      image.Digest,
+			Status:      image.Status,
+			Error:       image.Error,
+			Occurrences: image.Occurrences,
+		}
+		if scan.errs[i] == nil {
+			metadata := scan.metadata[i]
+			if metadata.Digest != "" {
+				v2.Digest = metadata.Digest
+			}
+			v2.ManifestDigest = metadata.ManifestDigest
+			v2.MediaType = metadata.MediaType
+			v2.Platform = metadata.Platform
+			v2.Created = metadata.Created
+			if !metadata.Fetched.IsZero() {
+				fetched := metadata.Fetched
+				v2.Fetched = &fetched
+			}
+			v2.CompressedBytes = metadata.Bytes
+			v2.UncompressedBytes = metadata.UncompressedBytes
+			v2.LayerCount = metadata.Layers
+			v2.Layers = metadata.LayerDetails
+			v2.Platforms = metadata.Platforms
+			v2.MissingPlatforms = metadata.MissingPlatforms
+		}
+		images = append(images, v2)
+	}
+	return images
+}
+
+// imageTotals sums up the images of a scan that were looked up
+func imageTotals(scan chartImages) models.ImageTotals {
+	var totals models.ImageTotals
+	var uncompressed int64
+	uncompressedKnown := true
+	layers := map[string]bool{}
+
+	for i, metadata := range scan.metadata {
+		if scan.errs[i] != nil {
+			continue
+		}
+		totals.Images++
+		totals.Layers += metadata.Layers
+		totals.CompressedBytes += metadata.Bytes
+		for _, p := range metadata.Platforms {
+			if totals.Platforms == nil {
+				totals.Platforms = map[string]int64{}
+			}
+			totals.Platforms[p.Platform] += p.CompressedBytes
+		}
+
+		if metadata.UncompressedBytes != nil {
+			uncompressed += *metadata.UncompressedBytes
+		} else {
+			uncompressedKnown = false
+		}
+
+		// Without layer details, the image counts as one unique layer
+		if len(metadata.LayerDetails) == 0 {
+			totals.UniqueLayerBytes += metadata.Bytes
+		}
+		for _, layer := range metadata.LayerDetails {
+			if !layers[layer.Digest] {
+				layers[layer.Digest] = true
+				totals.UniqueLayerBytes += layer.CompressedBytes
+			}
+		}
+	}
+
+	if uncompressedKnown && totals.Images > 0 {
+		totals.UncompressedBytes = &uncompressed
+	}
+	return totals
+}
+
+// validPlatforms reports whether platforms are all "*" or in
+// "os/arch[/variant]" form
+func validPlatforms(platforms []string) bool {
+	for _, platform := range platforms {
+		if platform == models.AllPlatforms {
+			continue
+		}
+		parts := strings.Split(platform, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			return false
+		}
+		for _, part := range parts {
+			if part == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupRecorder records the lookup options images are looked up with
+type lookupRecorder struct {
+	*MockHELMService
+	opts chan models.LookupOptions
+}
+
+func (s lookupRecorder) GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	s.opts <- opts
+	return s.MockHELMService.GetImageMetadata(ctx, imageName, opts)
+}
+
+func postV2(t *testing.T, handler *HELMHandler, body any) *httptest.ResponseRecorder {
+	jsonBody, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/v2/load-helm", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	setupTestRouter(handler).ServeHTTP(w, req)
+	return w
+}
+
+func TestLoadHELMV2(t *testing.T) {
+	mockService := new(MockHELMService)
+	service := lookupRecorder{MockHELMService: mockService, opts: make(chan models.LookupOptions, 3)}
+
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	fetched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	uncompressed := int64(3000)
+	shared := models.LayerMetadata{Digest: "sha256:base", MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", CompressedBytes: 1000}
+
+	doc := models.YAMLDocument{Source: "values.yaml"}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{
+		{Name: "nginx:1.25", Registry: "docker.io", Repository: "nginx", Tag: "1.25", Source: "values.yaml", Path: "image"},
+		{Name: "redis:7.2", Registry: "docker.io", Source: "values.yaml", Path: "redis.image"},
+		{Name: "ghcr.io/org/app:1.0", Registry: "ghcr.io", Source: "values.yaml", Path: "app.image"},
+	})
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{
+		Size: "1.46 KB", Bytes: 1500, Layers: 2,
+		Digest: "sha256:index", ManifestDigest: "sha256:manifest", MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Platform: "linux/amd64", Created: &created, Fetched: fetched, UncompressedBytes: &uncompressed,
+		LayerDetails: []models.LayerMetadata{shared, {Digest: "sha256:nginx", CompressedBytes: 500}},
+	}, nil)
+	mockService.On("GetImageMetadata", "redis:7.2").Return(models.ImageMetadata{
+		Size: "1.17 KB", Bytes: 1200, Layers: 2,
+		LayerDetails: []models.LayerMetadata{shared, {Digest: "sha256:redis", CompressedBytes: 200}},
+	}, nil)
+	mockService.On("GetImageMetadata", "ghcr.io/org/app:1.0").Return(models.ImageMetadata{}, &models.ImageError{Code: models.ImageErrorNotFound, Message: "manifest unknown"})
+	mockService.On("RegistryStats", []string{"docker.io", "ghcr.io"}).Return(nil)
+
+	w := postV2(t, NewHELMHandler(service), models.HELMRequestV2{HELMRequest: models.HELMRequest{URL: "http://example.com/chart.tgz"}, Uncompressed: true})
+	require.Equal(t, http.StatusOK, w.Code)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, models.LookupOptions{Details: true, Uncompressed: true}, <-service.opts)
+	}
+
+	var response models.ImagesResponseV2
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "v2", response.APIVersion)
+	require.True(t, response.Success)
+	require.Len(t, response.Images, 3)
+
+	nginx := response.Images[0]
+	require.Equal(t, "docker.io/library/nginx:1.25", nginx.Reference)
+	require.Equal(t, "sha256:index", nginx.Digest)
+	require.Equal(t, "sha256:manifest", nginx.ManifestDigest)
+	require.Equal(t, "application/vnd.oci.image.manifest.v1+json", nginx.MediaType)
+	require.Equal(t, "linux/amd64", nginx.Platform)
+	require.Equal(t, created, *nginx.Created)
+	require.Equal(t, fetched, *nginx.Fetched)
+	require.Equal(t, int64(1500), nginx.CompressedBytes)
+	require.Equal(t, int64(3000), *nginx.UncompressedBytes)
+	require.Equal(t, 2, nginx.LayerCount)
+	require.Len(t, nginx.Layers, 2)
+	require.Equal(t, models.ImageStatusOK, nginx.Status)
+	require.Equal(t, []models.ImageOccurrence{{Source: "values.yaml", Path: "image"}}, nginx.Occurrences)
+
+	app := response.Images[2]
+	require.Equal(t, models.ImageStatusError, app.Status)
+	require.Equal(t, models.ImageErrorNotFound, app.Error.Code)
+	require.Zero(t, app.CompressedBytes)
+
+	require.Equal(t, models.ImagesSummary{Total: 3, OK: 2, Failed: 1, Errors: map[string]int{models.ImageErrorNotFound: 1}}, response.Summary)
+	// The base layer shared by nginx and redis counts once; the uncompressed
+	// size of redis is unknown
+	require.Equal(t, models.ImageTotals{Images: 2, Layers: 4, CompressedBytes: 2700, UniqueLayerBytes: 1700}, response.Totals)
+	require.Equal(t, int64(2700), response.Footprint.NodeBytes)
+
+	// Sizes are numbers, not human-readable strings
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	image := raw["images"].([]any)[0].(map[string]any)
+	require.Equal(t, float64(1500), image["compressedBytes"])
+	require.NotContains(t, image, "size")
+}
+
+func TestLoadHELMV2_Errors(t *testing.T) {
+	mockService := new(MockHELMService)
+	handler := NewHELMHandler(mockService)
+
+	w := postV2(t, handler, map[string]any{})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.JSONEq(t, `{"apiVersion": "v2", "success": false, "error": "Invalid request format"}`, w.Body.String())
+
+	doc := models.YAMLDocument{Source: "values.yaml"}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{{Name: "nginx:1.25"}})
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{}, assert.AnError)
+
+	w = postV2(t, handler, models.HELMRequestV2{HELMRequest: models.HELMRequest{URL: "http://example.com/chart.tgz", Strict: true}})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response models.ErrorResponseV2
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "v2", response.APIVersion)
+	require.False(t, response.Success)
+	require.Contains(t, response.Error, "nginx:1.25")
+}
+
+func TestLoadHELMV2_Platforms(t *testing.T) {
+	mockService := new(MockHELMService)
+	service := lookupRecorder{MockHELMService: mockService, opts: make(chan models.LookupOptions, 2)}
+
+	doc := models.YAMLDocument{Source: "values.yaml"}
+	mockService.On("LoadAndParseYAML", "http://example.com/chart.tgz", models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return([]models.ContainerImage{{Name: "nginx:1.25"}, {Name: "legacy:1.0"}})
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{
+		Bytes: 3000, Layers: 2,
+		Platforms: []models.PlatformMetadata{
+			{Platform: "linux/amd64", Digest: "sha256:amd64", CompressedBytes: 3000, LayerCount: 2},
+			{Platform: "linux/arm64/v8", Digest: "sha256:arm64", CompressedBytes: 12000, LayerCount: 3},
+		},
+	}, nil)
+	mockService.On("GetImageMetadata", "legacy:1.0").Return(models.ImageMetadata{
+		Bytes: 700, Layers: 1,
+		Platforms:        []models.PlatformMetadata{{Platform: "linux/amd64", Digest: "sha256:legacy", CompressedBytes: 700, LayerCount: 1}},
+		MissingPlatforms: []string{"linux/arm64"},
+	}, nil)
+
+	handler := NewHELMHandler(service)
+	w := postV2(t, handler, models.HELMRequestV2{
+		HELMRequest: models.HELMRequest{URL: "http://example.com/chart.tgz"},
+		Platforms:   []string{"linux/amd64", "linux/arm64"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, models.LookupOptions{Details: true, Platforms: []string{"linux/amd64", "linux/arm64"}}, <-service.opts)
+	}
+
+	var response models.ImagesResponseV2
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Images[0].Platforms, 2)
+	require.Empty(t, response.Images[0].MissingPlatforms)
+	require.Equal(t, []string{"linux/arm64"}, response.Images[1].MissingPlatforms)
+	require.Equal(t, 1, response.Summary.MissingPlatforms)
+	require.Equal(t, map[string]int64{"linux/amd64": 3700, "linux/arm64/v8": 12000}, response.Totals.Platforms)
+
+	// Platforms must be "*" or os/arch[/variant]
+	for _, platforms := range [][]string{{"linux"}, {"linux/arm/v7/extra"}, {"linux//v7"}} {
+		w = postV2(t, handler, models.HELMRequestV2{HELMRequest: models.HELMRequest{URL: "http://example.com/chart.tgz"}, Platforms: platforms})
+		require.Equal(t, http.StatusBadRequest, w.Code, platforms)
+	}
+}
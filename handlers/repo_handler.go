@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"helm-viewer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRepoCharts handles the request to list the charts of a Helm repository
+func (h *HELMHandler) ListRepoCharts(c *gin.Context) {
+	var request models.RepoChartsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.HELMResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	charts, err := h.helmService.ListRepoCharts(ctx, request.Repo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.HELMResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RepoChartsResponse{
+		Success: true,
+		Charts:  charts,
+	})
+}
+
+// ScanRepoChart handles the request to scan a chart of a Helm repository by
+// name and version; the chart archive is analyzed like in LoadHELM
+func (h *HELMHandler) ScanRepoChart(c *gin.Context) {
+	var request models.RepoScanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.HELMResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	url, err := h.helmService.ResolveChartURL(ctx, request.Repo, request.Chart, request.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.HELMResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.loadChart(ctx, c, url, request.LoadOptions, request.Strict, request.Nodes)
+}
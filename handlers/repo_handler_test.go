@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRepoCharts_Success(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	charts := []models.RepoChart{
+		{Name: "nginx", LatestVersion: "1.0.0", Versions: []models.RepoChartVersion{{Version: "1.0.0"}}},
+	}
+	mockService.On("ListRepoCharts", "https://charts.example.com").Return(charts, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/repo-charts", bytes.NewBufferString(`{"repo": "https://charts.example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.RepoChartsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Equal(t, charts[0].Name, response.Charts[0].Name)
+	require.Equal(t, "1.0.0", response.Charts[0].LatestVersion)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestListRepoCharts_Errors(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	req := httptest.NewRequest(http.MethodPost, "/repo-charts", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.On("ListRepoCharts", "https://charts.example.com").Return(nil, assert.AnError)
+
+	req = httptest.NewRequest(http.MethodPost, "/repo-charts", bytes.NewBufferString(`{"repo": "https://charts.example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestScanRepoChart_Success(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	chartURL := "https://charts.example.com/nginx-1.0.0.tgz"
+	yamlContent := map[string]interface{}{"image": "nginx:1.25"}
+	images := []models.ContainerImage{{Name: "nginx:1.25", Source: "nginx/values.yaml"}}
+
+	mockService.On("ResolveChartURL", "https://charts.example.com", "nginx", "").Return(chartURL, nil)
+	doc := models.YAMLDocument{Source: "nginx/values.yaml", Chart: "nginx", Content: yamlContent}
+	mockService.On("LoadAndParseYAML", chartURL, models.LoadOptions{}).Return([]models.YAMLDocument{doc}, nil)
+	mockService.On("FindDocumentImages", doc).Return(images)
+	mockService.On("GetImageMetadata", "nginx:1.25").Return(models.ImageMetadata{Size: "50.00 MB", Layers: 3}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/repo-scan", bytes.NewBufferString(`{"repo": "https://charts.example.com", "chart": "nginx"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ImagesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Len(t, response.Images, 1)
+	require.Equal(t, "nginx/values.yaml", response.Images[0].Source)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestScanRepoChart_ResolveError(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	mockService.On("ResolveChartURL", "https://charts.example.com", "nginx", "9.9.9").Return("", assert.AnError)
+
+	req := httptest.NewRequest(http.MethodPost, "/repo-scan", bytes.NewBufferString(`{"repo": "https://charts.example.com", "chart": "nginx", "version": "9.9.9"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response models.HELMResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, assert.AnError.Error(), response.Error)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"helm-viewer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRegistryStats handles the request for the circuit breaker state and
+// request counts of every registry contacted
+func (h *HELMHandler) GetRegistryStats(c *gin.Context) {
+	c.JSON(http.StatusOK, models.RegistriesResponse{
+		Success:    true,
+		Registries: h.helmService.RegistryStats(),
+	})
+}
+
+// GetRegistryQuotas handles the request for the quotas registries report
+// per credential
+func (h *HELMHandler) GetRegistryQuotas(c *gin.Context) {
+	c.JSON(http.StatusOK, models.RegistryQuotasResponse{
+		Success: true,
+		Quotas:  h.helmService.RegistryQuotas(),
+	})
+}
+
+// GetCacheStats handles the request for the image metadata cache statistics
+func (h *HELMHandler) GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, models.CacheStatsResponse{
+		Success: true,
+		Cache:   h.helmService.CacheStats(),
+	})
+}
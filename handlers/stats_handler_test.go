@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCacheStats(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	mockService.On("CacheStats").Return(models.CacheStats{Hits: 7, Misses: 3})
+
+	req := httptest.NewRequest(http.MethodGet, "/cache-stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CacheStatsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Equal(t, models.CacheStats{Hits: 7, Misses: 3}, response.Cache)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetRegistryStats(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	stats := []models.RegistryStats{
+		{Registry: "docker.io", Circuit: "closed", Requests: 10, Retries: 1},
+		{Registry: "ghcr.io", Circuit: "open", Requests: 5, Errors: 5, Trips: 1},
+	}
+	mockService.On("RegistryStats", []string(nil)).Return(stats)
+
+	req := httptest.NewRequest(http.MethodGet, "/registry-stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.RegistriesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Equal(t, stats, response.Registries)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetRegistryQuotas(t *testing.T) {
+	mockService := new(MockHELMService)
+	router := setupTestRouter(NewHELMHandler(mockService))
+
+	quotas := []models.RegistryQuota{
+		{Registry: "docker.io", Credential: "anonymous", Limit: 100, Remaining: 8, Window: 21600, Low: true, Rate: 2, Burst: 5},
+	}
+	mockService.On("RegistryQuotas").Return(quotas)
+
+	req := httptest.NewRequest(http.MethodGet, "/registry-quotas", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.RegistryQuotasResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.Success)
+	require.Equal(t, quotas, response.Quotas)
+
+	mockService.AssertExpectations(t)
+}
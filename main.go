@@ -9,8 +9,14 @@ import (
 
 func main() {
 	cfg := config.NewConfig()
+	if err := cfg.LoadCredentials(); err != nil {
+		log.Fatalf("Failed to load registry credentials: %v", err)
+	}
+	if err := cfg.LoadExtractionRules(); err != nil {
+		log.Fatalf("Failed to load extraction rules: %v", err)
+	}
 
-	r := router.SetupRouter()
+	r := router.SetupRouter(cfg)
 
 	log.Printf("Server starting on port %s", cfg.Port)
 	if err := r.Run(":" + cfg.Port); err != nil {
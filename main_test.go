@@ -16,12 +16,12 @@ func TestConfigInitialization(t *testing.T) {
 }
 
 func TestRouterSetup(t *testing.T) {
-	r := router.SetupRouter()
+	r := router.SetupRouter(config.NewConfig())
 	require.NotNil(t, r)
 }
 
 func TestServerStartErrorHandling(t *testing.T) {
-	r := router.SetupRouter()
+	r := router.SetupRouter(config.NewConfig())
 	err := r.Run("invalid-port")
 	require.Error(t, err)
 }
@@ -1,13 +1,53 @@
 package models
 
-// YAMLDocument represents a loaded YAML document
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLDocument represents a loaded YAML document. Chart is the name of the
+// chart the document belongs to, if any. Values reports whether Content holds
+// chart values, whose paths can be overridden with --set, and ValuesPrefix is
+// the path of those values in the top-level chart, e.g. "redis" for a
+// subchart. Node is the parsed source file, used to locate image positions.
 type YAMLDocument struct {
-	Content interface{} `json:"content"`
+	Source       string      `json:"source,omitempty"`
+	Chart        string      `json:"chart,omitempty"`
+	Values       bool        `json:"values,omitempty"`
+	ValuesPrefix string      `json:"valuesPrefix,omitempty"`
+	Content      interface{} `json:"content"`
+	Node         *yaml.Node  `json:"-"`
+}
+
+// LoadOptions controls how a chart is turned into documents. With Render set,
+// the chart templates are rendered like `helm template` and images are
+// discovered in the rendered manifests; ReleaseName, Namespace and
+// KubeVersion fill .Release and .Capabilities. ValuesFiles (URLs), Values and
+// Set (`--set` expressions) override the chart values, in that order of
+// increasing precedence, like `helm template -f ... --set ...`.
+type LoadOptions struct {
+	Render      bool           `json:"render,omitempty"`
+	ReleaseName string         `json:"releaseName,omitempty"`
+	Namespace   string         `json:"namespace,omitempty"`
+	KubeVersion string         `json:"kubeVersion,omitempty"`
+	ValuesFiles []string       `json:"valuesFiles,omitempty"`
+	Values      map[string]any `json:"values,omitempty"`
+	Set         []string       `json:"set,omitempty"`
 }
 
-// HELMRequest represents a request to load YAML
+// HELMRequest represents a request to load YAML. Version selects the chart
+// version of oci:// URLs, like `helm pull --version`. Strict fails the whole
+// request on the first image that cannot be looked up instead of returning
+// partial results. Nodes is the node count of the cluster the image footprint
+// is estimated for, 1 by default. Filtering by platform is only available in
+// HELMRequestV2.
 type HELMRequest struct {
-	URL string `json:"url" binding:"required"`
+	URL     string `json:"url" binding:"required"`
+	Version string `json:"version,omitempty"`
+	Strict  bool   `json:"strict,omitempty"`
+	Nodes   int    `json:"nodes,omitempty" binding:"omitempty,min=1"`
+	LoadOptions
 }
 
 // HELMResponse represents the server response
@@ -19,14 +59,306 @@ type HELMResponse struct {
 
 // ContainerImage represents container image information
 type ContainerImage struct {
-	Name      string `json:"name"`
-	Container string `json:"container,omitempty"`
-	Size      string `json:"size,omitempty"`
-	Layers    int    `json:"layers"`
+	Name string `json:"name"`
+	// Reference is the normalized image reference
+	Reference  string `json:"reference,omitempty"`
+	Registry   string `json:"registry,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Container  string `json:"container,omitempty"`
+	// Role is init, main or ephemeral for the containers of workloads
+	Role string `json:"role,omitempty"`
+	// PullPolicy is defaulted like Kubernetes when the manifest does not set it
+	PullPolicy string `json:"imagePullPolicy,omitempty"`
+	Source     string `json:"source,omitempty"`
+	// Path is the dotted path of the image in its source file, e.g.
+	// "controller.image", at Line and Column
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// Set is a `--set` expression overriding the image in chart values
+	Set string `json:"set,omitempty"`
+	// Workload is the "Kind/name" of the workload manifest, one with a pod
+	// spec, the image was found in
+	Workload string `json:"workload,omitempty"`
+	// Replicas is the pod count of the workload, unset for DaemonSets,
+	// which run on every node
+	Replicas *int      `json:"replicas,omitempty"`
+	Resource *Resource `json:"resource,omitempty"`
+	Size     string    `json:"size,omitempty"`
+	Layers   int       `json:"layers"`
+
+	// Status tells whether the image metadata was looked up, with the
+	// reason in Error when it was not
+	Status string      `json:"status,omitempty"`
+	Error  *ImageError `json:"error,omitempty"`
+
+	// Occurrences are the places an image found several times was found in
+	Occurrences []ImageOccurrence `json:"occurrences,omitempty"`
+}
+
+// ImageMetadata is the metadata of an image looked up in its registry: its
+// compressed size, human-readable in Size and in Bytes, and its layer count.
+// Detailed lookups add the digests the reference resolved to, the manifest
+// media type and layers, the platform and creation time from the image
+// configuration, and optionally the uncompressed sizes and the images of
+// other platforms, with the requested or configured platforms the image lacks
+// in MissingPlatforms. Fetched is when the metadata was read from the registry.
+type ImageMetadata struct {
+	Size   string
+	Bytes  int64
+	Layers int
+
+	Digest            string
+	ManifestDigest    string
+	MediaType         string
+	Platform          string
+	Created           *time.Time
+	Fetched           time.Time
+	UncompressedBytes *int64
+	LayerDetails      []LayerMetadata
+	Platforms         []PlatformMetadata
+	MissingPlatforms  []string
+}
+
+// PlatformMetadata is the image of one platform of an image: the digest,
+// compressed size and layer count of its manifest
+type PlatformMetadata struct {
+	Platform        string `json:"platform"`
+	Digest          string `json:"digest"`
+	CompressedBytes int64  `json:"compressedBytes"`
+	LayerCount      int    `json:"layerCount"`
+}
+
+// LayerMetadata is a layer of an image; UncompressedBytes is only known when
+// asked for
+type LayerMetadata struct {
+	Digest            string `json:"digest"`
+	MediaType         string `json:"mediaType,omitempty"`
+	CompressedBytes   int64  `json:"compressedBytes"`
+	UncompressedBytes *int64 `json:"uncompressedBytes,omitempty"`
+}
+
+// LookupOptions selects the optional parts of an image lookup
+type LookupOptions struct {
+	// Details reads the manifest and image configuration details, at the
+	// cost of a request for the image configuration
+	Details bool
+	// Uncompressed measures the uncompressed layer sizes, downloading every
+	// layer not measured before
+	Uncompressed bool
+	// Platforms inspects the images of these platforms ("os/arch[/variant]",
+	// or "*" for every platform), at the cost of a request for the image
+	// index and for each platform manifest not looked up before
+	Platforms []string
 }
 
-// ImagesResponse represents the response containing container images
+// AllPlatforms selects every platform of an image in LookupOptions.Platforms
+const AllPlatforms = "*"
+
+// Roles of the containers of workloads
+const (
+	ContainerRoleInit      = "init"
+	ContainerRoleMain      = "main"
+	ContainerRoleEphemeral = "ephemeral"
+)
+
+// Image pull policies
+const (
+	PullPolicyAlways       = "Always"
+	PullPolicyIfNotPresent = "IfNotPresent"
+)
+
+// Image statuses
+const (
+	ImageStatusOK    = "ok"
+	ImageStatusError = "error"
+)
+
+// Image error codes
+const (
+	ImageErrorNotFound         = "not_found"
+	ImageErrorUnauthorized     = "unauthorized"
+	ImageErrorRateLimited      = "rate_limited"
+	ImageErrorTimeout          = "timeout"
+	ImageErrorInvalidReference = "invalid_reference"
+	ImageErrorCircuitOpen      = "circuit_open"
+	ImageErrorUnknown          = "unknown"
+)
+
+// ImageError is the reason an image could not be looked up
+type ImageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ImageError) Error() string {
+	return e.Message
+}
+
+// ImageOccurrence represents a place an image was found in
+type ImageOccurrence struct {
+	Source     string    `json:"source,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Line       int       `json:"line,omitempty"`
+	Column     int       `json:"column,omitempty"`
+	Set        string    `json:"set,omitempty"`
+	Container  string    `json:"container,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	PullPolicy string    `json:"imagePullPolicy,omitempty"`
+	Workload   string    `json:"workload,omitempty"`
+	Replicas   *int      `json:"replicas,omitempty"`
+	Resource   *Resource `json:"resource,omitempty"`
+}
+
+// Resource identifies the Kubernetes resource an image was found in
+type Resource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// ImagesResponse represents the response containing container images;
+// Registries are the registries of the images
 type ImagesResponse struct {
-	Success bool             `json:"success"`
-	Images  []ContainerImage `json:"images"`
+	Success    bool             `json:"success"`
+	Images     []ContainerImage `json:"images"`
+	Summary    ImagesSummary    `json:"summary"`
+	Footprint  Footprint        `json:"footprint"`
+	Registries []RegistryStats  `json:"registries,omitempty"`
+}
+
+// Footprint estimates the image data that lands on the nodes of a cluster,
+// in bytes. NodeBytes is the worst case of a single node, running a pod of
+// every workload; PullBytes is the cluster-wide pull volume when the pods of
+// an image are spread over as many nodes as possible, each node pulling it
+// once. Images whose size is unknown are left out and counted in Missing.
+type Footprint struct {
+	Nodes     int                 `json:"nodes"`
+	NodeBytes int64               `json:"nodeBytes"`
+	PullBytes int64               `json:"pullBytes"`
+	Missing   int                 `json:"missing,omitempty"`
+	Workloads []WorkloadFootprint `json:"workloads,omitempty"`
+}
+
+// WorkloadFootprint is the image data of a workload: Bytes of unique images
+// per pod, and PullBytes pulled for its Pods, DaemonSets running one pod per
+// node
+type WorkloadFootprint struct {
+	Workload  string `json:"workload"`
+	Namespace string `json:"namespace,omitempty"`
+	Pods      int    `json:"pods"`
+	Bytes     int64  `json:"bytes"`
+	PullBytes int64  `json:"pullBytes"`
+}
+
+// ImagesSummary counts the images that were and were not looked up; Errors
+// counts the failed images by error code, and MissingPlatforms the images
+// lacking a requested platform
+type ImagesSummary struct {
+	Total            int            `json:"total"`
+	OK               int            `json:"ok"`
+	Failed           int            `json:"failed"`
+	Errors           map[string]int `json:"errors,omitempty"`
+	MissingPlatforms int            `json:"missingPlatforms,omitempty"`
+}
+
+// RegistryStats is the circuit breaker state of a registry ("closed", "open"
+// or "half_open") with its request, retry, error and circuit trip counts.
+// OpenUntil is when an open circuit lets a trial request through.
+type RegistryStats struct {
+	Registry  string     `json:"registry"`
+	Circuit   string     `json:"circuit"`
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+	Requests  int64      `json:"requests"`
+	Retries   int64      `json:"retries"`
+	Errors    int64      `json:"errors"`
+	Trips     int64      `json:"trips"`
+}
+
+// RegistriesResponse represents the response containing registry statistics
+type RegistriesResponse struct {
+	Success    bool            `json:"success"`
+	Registries []RegistryStats `json:"registries"`
+}
+
+// RegistryQuota is the request quota a registry reports for a credential in
+// its ratelimit headers
+type RegistryQuota struct {
+	Registry string `json:"registry"`
+	// Credential is "anonymous" or the username masked as "user-" and a
+	// short hash
+	Credential string `json:"credential"`
+	// Limit requests per Window seconds, Remaining of them left when Updated
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Window    int64     `json:"window"`
+	Updated   time.Time `json:"updated"`
+	// Low quotas are paced; exhausted ones fail until ResetAt
+	Low     bool       `json:"low"`
+	ResetAt *time.Time `json:"resetAt,omitempty"`
+	// Rate and Burst are the configured token bucket of the registry
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// RegistryQuotasResponse represents the response containing registry quotas
+type RegistryQuotasResponse struct {
+	Success bool            `json:"success"`
+	Quotas  []RegistryQuota `json:"quotas"`
+}
+
+// CacheStats counts the image lookups answered from the metadata cache
+// (Hits) and from registries (Misses)
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// CacheStatsResponse represents the response containing cache statistics
+type CacheStatsResponse struct {
+	Success bool       `json:"success"`
+	Cache   CacheStats `json:"cache"`
+}
+
+// RepoChartsRequest represents a request to list the charts of a Helm repository
+type RepoChartsRequest struct {
+	Repo string `json:"repo" binding:"required"`
+}
+
+// RepoScanRequest represents a request to scan a chart of a Helm repository.
+// Version may be an exact version or a constraint; empty means latest stable.
+// Strict and Nodes have the same meaning as in HELMRequest.
+type RepoScanRequest struct {
+	Repo    string `json:"repo" binding:"required"`
+	Chart   string `json:"chart" binding:"required"`
+	Version string `json:"version,omitempty"`
+	Strict  bool   `json:"strict,omitempty"`
+	Nodes   int    `json:"nodes,omitempty" binding:"omitempty,min=1"`
+	LoadOptions
+}
+
+// RepoChartVersion represents a version of a chart in a Helm repository
+type RepoChartVersion struct {
+	Version    string    `json:"version"`
+	AppVersion string    `json:"appVersion,omitempty"`
+	Created    time.Time `json:"created,omitempty"`
+	Deprecated bool      `json:"deprecated,omitempty"`
+}
+
+// RepoChart represents a chart in a Helm repository with its versions, newest first
+type RepoChart struct {
+	Name          string             `json:"name"`
+	Description   string             `json:"description,omitempty"`
+	LatestVersion string             `json:"latestVersion,omitempty"`
+	Versions      []RepoChartVersion `json:"versions"`
+}
+
+// RepoChartsResponse represents the response containing the charts of a Helm repository
+type RepoChartsResponse struct {
+	Success bool        `json:"success"`
+	Charts  []RepoChart `json:"charts"`
 }
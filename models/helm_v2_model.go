@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// APIVersionV2 is the schema version of the /api/v2 responses
+const APIVersionV2 = "v2"
+
+// HELMRequestV2 represents a request to load YAML with the v2 response
+// schema; Uncompressed and Platforms set the lookup options of the same name
+type HELMRequestV2 struct {
+	HELMRequest
+	Uncompressed bool     `json:"uncompressed,omitempty"`
+	Platforms    []string `json:"platforms,omitempty"`
+}
+
+// ImageV2 is a container image in the v2 response schema. Sizes are in
+// bytes; Digest is the digest the reference resolved to, the image index for
+// multi-platform images, and ManifestDigest the digest of the manifest of
+// Platform. Created comes from the image configuration, and Fetched is when
+// the metadata was read from the registry. Platforms are the images of the
+// requested platforms, and MissingPlatforms the requested platforms the image
+// lacks. Occurrences are the places the image was found in.
+type ImageV2 struct {
+	Name              string             `json:"name"`
+	Reference         string             `json:"reference"`
+	Registry          string             `json:"registry,omitempty"`
+	Namespace         string             `json:"namespace,omitempty"`
+	Repository        string             `json:"repository,omitempty"`
+	Tag               string             `json:"tag,omitempty"`
+	Digest            string             `json:"digest,omitempty"`
+	ManifestDigest    string             `json:"manifestDigest,omitempty"`
+	MediaType         string             `json:"mediaType,omitempty"`
+	Platform          string             `json:"platform,omitempty"`
+	Created           *time.Time         `json:"created,omitempty"`
+	Fetched           *time.Time         `json:"fetched,omitempty"`
+	CompressedBytes   int64              `json:"compressedBytes"`
+	UncompressedBytes *int64             `json:"uncompressedBytes,omitempty"`
+	LayerCount        int                `json:"layerCount"`
+	Layers            []LayerMetadata    `json:"layers,omitempty"`
+	Platforms         []PlatformMetadata `json:"platforms,omitempty"`
+	MissingPlatforms  []string           `json:"missingPlatforms,omitempty"`
+	Status            string             `json:"status"`
+	Error             *ImageError        `json:"error,omitempty"`
+	Occurrences       []ImageOccurrence  `json:"occurrences"`
+}
+
+// ImageTotals sums up the images that were looked up. UniqueLayerBytes counts
+// layers shared by several images once; UncompressedBytes is only set when
+// the uncompressed size of every image is known. Platforms sums up the
+// compressed size of the images of each inspected platform.
+type ImageTotals struct {
+	Images            int              `json:"images"`
+	Layers            int              `json:"layers"`
+	CompressedBytes   int64            `json:"compressedBytes"`
+	UniqueLayerBytes  int64            `json:"uniqueLayerBytes"`
+	UncompressedBytes *int64           `json:"uncompressedBytes,omitempty"`
+	Platforms         map[string]int64 `json:"platforms,omitempty"`
+}
+
+// ImagesResponseV2 represents the v2 response containing container images
+type ImagesResponseV2 struct {
+	APIVersion string          `json:"apiVersion"`
+	Success    bool            `json:"success"`
+	Images     []ImageV2       `json:"images"`
+	Summary    ImagesSummary   `json:"summary"`
+	Totals     ImageTotals     `json:"totals"`
+	Footprint  Footprint       `json:"footprint"`
+	Registries []RegistryStats `json:"registries,omitempty"`
+}
+
+// ErrorResponseV2 represents a failed v2 request
+type ErrorResponseV2 struct {
+	APIVersion string `json:"apiVersion"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+}
@@ -0,0 +1,172 @@
+package reference
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DockerHubRegistry is the registry used for references without a registry host
+	DockerHubRegistry = "docker.io"
+	// OfficialNamespace is the Docker Hub namespace of single-component references
+	OfficialNamespace = "library"
+	// DefaultTag is used for references with neither a tag nor a digest
+	DefaultTag = "latest"
+
+	// maxNameLength is the maximum length of the registry and path of a reference
+	maxNameLength = 255
+)
+
+var (
+	registryRegexp      = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*|\[[0-9a-fA-F:]+\])(?::[0-9]+)?$`)
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// dockerHubAliases are registry hosts that refer to Docker Hub
+var dockerHubAliases = map[string]bool{
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
+
+// Reference is a parsed and normalized container image reference
+type Reference struct {
+	Registry   string
+	Namespace  string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Parse parses and validates an image reference such as "nginx",
+// "localhost:5000/team/app:1.2" or "ghcr.io/org/app@sha256:...".
+// References without a registry resolve to Docker Hub, single-component
+// Docker Hub references to the "library" namespace, and references with
+// neither tag nor digest get the "latest" tag.
+func Parse(s string) (Reference, error) {
+	if s == "" {
+		return Reference{}, fmt.Errorf("invalid reference: empty string")
+	}
+
+	name := s
+	var ref Reference
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("invalid reference %q: invalid digest %q", s, ref.Digest)
+		}
+	}
+
+	// A tag separator is the last ":" after the last "/", so registry ports are kept
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("invalid reference %q: invalid tag %q", s, ref.Tag)
+		}
+	}
+
+	if len(name) > maxNameLength {
+		return Reference{}, fmt.Errorf("invalid reference %q: name longer than %d characters", s, maxNameLength)
+	}
+
+	ref.Registry = DockerHubRegistry
+	if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+		ref.Registry = name[:i]
+		name = name[i+1:]
+		if !registryRegexp.MatchString(ref.Registry) {
+			return Reference{}, fmt.Errorf("invalid reference %q: invalid registry %q", s, ref.Registry)
+		}
+	}
+	if dockerHubAliases[ref.Registry] {
+		ref.Registry = DockerHubRegistry
+	}
+
+	components := strings.Split(name, "/")
+	for _, c := range components {
+		if !pathComponentRegexp.MatchString(c) {
+			return Reference{}, fmt.Errorf("invalid reference %q: invalid path component %q", s, c)
+		}
+	}
+
+	if ref.Registry == DockerHubRegistry && len(components) == 1 {
+		components = []string{OfficialNamespace, components[0]}
+	}
+	ref.Namespace = strings.Join(components[:len(components)-1], "/")
+	ref.Repository = components[len(components)-1]
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+
+	return ref, nil
+}
+
+// isRegistryHost reports whether the first path component of a reference is
+// a registry host rather than a namespace
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:[") || component == "localhost" ||
+		strings.ToLower(component) != component
+}
+
+// Path returns the repository path within the registry, e.g. "library/nginx"
+func (r Reference) Path() string {
+	if r.Namespace == "" {
+		return r.Repository
+	}
+	return r.Namespace + "/" + r.Repository
+}
+
+// Name returns the fully qualified repository name, e.g. "docker.io/library/nginx"
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Path()
+}
+
+// Identifier returns the digest if present, otherwise the tag
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// String returns the fully qualified reference, e.g. "docker.io/library/nginx:latest"
+func (r Reference) String() string {
+	return r.Name() + r.suffix()
+}
+
+// FamiliarString returns the shortest equivalent reference, e.g. "nginx:latest"
+func (r Reference) FamiliarString() string {
+	if r.Registry != DockerHubRegistry {
+		return r.String()
+	}
+	return strings.TrimPrefix(r.Path(), OfficialNamespace+"/") + r.suffix()
+}
+
+// suffix returns the ":tag" and "@digest" parts of the reference
+func (r Reference) suffix() string {
+	var b strings.Builder
+	if r.Tag != "" {
+		b.WriteString(":" + r.Tag)
+	}
+	if r.Digest != "" {
+		b.WriteString("@" + r.Digest)
+	}
+	return b.String()
+}
+
+// Join builds an image name from a Helm-style repository and tag. A tag that
+// looks like a digest is appended with "@" and an empty tag is left out.
+func Join(repository, tag string) string {
+	switch {
+	case tag == "":
+		return repository
+	case digestRegexp.MatchString(tag):
+		return repository + "@" + tag
+	}
+	return repository + ":" + tag
+}
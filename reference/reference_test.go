@@ -0,0 +1,112 @@
+package reference
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testDigest = "sha256:" + strings.Repeat("a", 64)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Reference
+		str      string
+		familiar string
+	}{
+		{
+			input:    "nginx",
+			expected: Reference{Registry: "docker.io", Namespace: "library", Repository: "nginx", Tag: "latest"},
+			str:      "docker.io/library/nginx:latest",
+			familiar: "nginx:latest",
+		},
+		{
+			input:    "bitnami/redis:7.2",
+			expected: Reference{Registry: "docker.io", Namespace: "bitnami", Repository: "redis", Tag: "7.2"},
+			str:      "docker.io/bitnami/redis:7.2",
+			familiar: "bitnami/redis:7.2",
+		},
+		{
+			input:    "index.docker.io/library/nginx:1.25",
+			expected: Reference{Registry: "docker.io", Namespace: "library", Repository: "nginx", Tag: "1.25"},
+			str:      "docker.io/library/nginx:1.25",
+			familiar: "nginx:1.25",
+		},
+		{
+			input:    "localhost:5000/app:1.2",
+			expected: Reference{Registry: "localhost:5000", Repository: "app", Tag: "1.2"},
+			str:      "localhost:5000/app:1.2",
+			familiar: "localhost:5000/app:1.2",
+		},
+		{
+			input:    "registry.internal:5000/team/sub/svc",
+			expected: Reference{Registry: "registry.internal:5000", Namespace: "team/sub", Repository: "svc", Tag: "latest"},
+			str:      "registry.internal:5000/team/sub/svc:latest",
+			familiar: "registry.internal:5000/team/sub/svc:latest",
+		},
+		{
+			input:    "nginx@" + testDigest,
+			expected: Reference{Registry: "docker.io", Namespace: "library", Repository: "nginx", Digest: testDigest},
+			str:      "docker.io/library/nginx@" + testDigest,
+			familiar: "nginx@" + testDigest,
+		},
+		{
+			input:    "ghcr.io/org/app:1.0@" + testDigest,
+			expected: Reference{Registry: "ghcr.io", Namespace: "org", Repository: "app", Tag: "1.0", Digest: testDigest},
+			str:      "ghcr.io/org/app:1.0@" + testDigest,
+			familiar: "ghcr.io/org/app:1.0@" + testDigest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			ref, err := Parse(tc.input)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ref)
+			require.Equal(t, tc.str, ref.String())
+			require.Equal(t, tc.familiar, ref.FamiliarString())
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	testCases := []string{
+		"",
+		"Nginx",
+		"nginx:",
+		"nginx:-bad",
+		"nginx@sha256:short",
+		"ghcr.io/",
+		"org//app",
+		"bad_-_name/app",
+		"host:port/app",
+		strings.Repeat("a", 256),
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			_, err := Parse(tc)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestReference_Accessors(t *testing.T) {
+	ref, err := Parse("quay.io/org/app@" + testDigest)
+	require.NoError(t, err)
+	require.Equal(t, "org/app", ref.Path())
+	require.Equal(t, "quay.io/org/app", ref.Name())
+	require.Equal(t, testDigest, ref.Identifier())
+
+	ref, err = Parse("quay.io/org/app:2.0")
+	require.NoError(t, err)
+	require.Equal(t, "2.0", ref.Identifier())
+}
+
+func TestJoin(t *testing.T) {
+	require.Equal(t, "nginx", Join("nginx", ""))
+	require.Equal(t, "nginx:1.25", Join("nginx", "1.25"))
+	require.Equal(t, "nginx@"+testDigest, Join("nginx", testDigest))
+}
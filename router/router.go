@@ -1,23 +1,62 @@
 package router
 
 import (
+	"log"
+
+	"helm-viewer/config"
 	"helm-viewer/handlers"
 	"helm-viewer/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter() *gin.Engine {
+func SetupRouter(cfg *config.Config) *gin.Engine {
 	r := gin.Default()
 
 	helmService := services.NewHELMService()
+	helmService.SetInsecureRegistries(cfg.InsecureRegistries...)
+	if cfg.Credentials != nil {
+		helmService.SetCredentialsProvider(cfg.Credentials)
+	}
+	helmService.SetExtractionRules(cfg.ExtractionRules)
+	helmService.SetMaxConcurrentLookups(cfg.MaxConcurrentLookups)
+	helmService.SetHTTPTimeouts(cfg.ConnectTimeout, cfg.ReadTimeout)
+	helmService.SetCache(cacheBackend(cfg), cfg.CacheTagTTL)
+	helmService.SetRetryPolicy(cfg.RetryAttempts, cfg.RetryBaseDelay, cfg.RetryMaxDelay)
+	helmService.SetCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	helmService.SetRateLimits(cfg.RateLimits, cfg.LowQuota)
 
 	helmHandler := handlers.NewHELMHandler(helmService)
+	helmHandler.SetLookupConcurrency(cfg.LookupConcurrency)
+	helmHandler.SetRequestTimeout(cfg.RequestTimeout)
 
 	api := r.Group("/api")
 	{
 		api.POST("/helm/load", helmHandler.LoadHELM)
+		api.POST("/helm/repo/charts", helmHandler.ListRepoCharts)
+		api.POST("/helm/repo/scan", helmHandler.ScanRepoChart)
+		api.GET("/cache/stats", helmHandler.GetCacheStats)
+		api.GET("/registries", helmHandler.GetRegistryStats)
+		api.GET("/admin/quotas", helmHandler.GetRegistryQuotas)
+	}
+
+	v2 := r.Group("/api/v2")
+	{
+		v2.POST("/helm/load", helmHandler.LoadHELMV2)
 	}
 
 	return r
 }
+
+// cacheBackend returns the image metadata cache backend: the cache file when
+// one is configured, memory otherwise
+func cacheBackend(cfg *config.Config) services.CacheBackend {
+	if cfg.CacheFile != "" {
+		cache, err := services.NewDiskCache(cfg.CacheFile)
+		if err == nil {
+			return cache
+		}
+		log.Printf("Using the in-memory cache: %v", err)
+	}
+	return services.NewMemoryCache(cfg.CacheSize)
+}
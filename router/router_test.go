@@ -3,15 +3,18 @@ package router
 import (
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
+	"helm-viewer/config"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSetupRouter(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	r := SetupRouter()
+	r := SetupRouter(config.NewConfig())
 	require.NotNil(t, r)
 
 	// Test if the router has the expected routes
@@ -20,20 +23,22 @@ func TestSetupRouter(t *testing.T) {
 	// Check if we have the expected number of routes
 	require.Greater(t, len(routes), 0)
 
-	// Check if our specific endpoint exists
-	found := false
-	for _, route := range routes {
-		if route.Path == "/api/helm/load" && route.Method == "POST" {
-			found = true
-			break
+	// Check if our specific endpoints exist
+	for _, path := range []string{"/api/helm/load", "/api/helm/repo/charts", "/api/helm/repo/scan", "/api/v2/helm/load"} {
+		found := false
+		for _, route := range routes {
+			if route.Path == path && route.Method == "POST" {
+				found = true
+				break
+			}
 		}
+		require.True(t, found, "Expected POST %s endpoint not found", path)
 	}
-	require.True(t, found, "Expected POST /api/helm/load endpoint not found")
 }
 
 func TestHELMEndpoint(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	r := SetupRouter()
+	r := SetupRouter(config.NewConfig())
 
 	// Test the endpoint with a POST request
 	w := httptest.NewRecorder()
@@ -43,3 +48,17 @@ func TestHELMEndpoint(t *testing.T) {
 	// We expect a 400 Bad Request since we're not sending any data
 	require.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestCacheStatsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.NewConfig()
+	cfg.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	r := SetupRouter(cfg)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/cache/stats", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"success": true, "cache": {"hits": 0, "misses": 0}}`, w.Body.String())
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"helm-viewer/config"
+)
+
+const (
+	// defaultTokenLifetime is used when a token response carries no expires_in,
+	// as required by the Docker token authentication specification
+	defaultTokenLifetime = 60 * time.Second
+	// tokenExpiryMargin renews tokens shortly before they actually expire
+	tokenExpiryMargin = 5 * time.Second
+	// oauthClientID identifies the service in OAuth2 token requests
+	oauthClientID = "helm-viewer"
+)
+
+// CredentialsProvider looks up the credentials for a registry host
+type CredentialsProvider interface {
+	Lookup(ctx context.Context, registry string) (config.Credentials, bool, error)
+}
+
+// authChallenge is a parsed WWW-Authenticate header
+type authChallenge struct {
+	Scheme     string
+	Parameters map[string]string
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry",scope="repository:app:pull"`
+func parseAuthChallenge(header string) (authChallenge, error) {
+	header = strings.TrimSpace(header)
+	scheme, rest, _ := strings.Cut(header, " ")
+	if scheme == "" {
+		return authChallenge{}, fmt.Errorf("empty authentication challenge")
+	}
+
+	challenge := authChallenge{
+		Scheme:     strings.ToLower(scheme),
+		Parameters: map[string]string{},
+	}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return authChallenge{}, fmt.Errorf("invalid authentication challenge parameter %q", rest)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if strings.HasPrefix(value, `"`) {
+			// Quoted values may contain commas, e.g. "repository:app:pull,push"
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				return authChallenge{}, fmt.Errorf("unterminated quoted value for %q", key)
+			}
+			challenge.Parameters[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			challenge.Parameters[key], rest, _ = strings.Cut(value, ",")
+			challenge.Parameters[key] = strings.TrimSpace(challenge.Parameters[key])
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return challenge, nil
+}
+
+// bearerToken is a cached registry token and the credential it was
+// obtained with
+type bearerToken struct {
+	value      string
+	credential string
+	expiresAt  time.Time
+}
+
+// tokenCache stores bearer tokens per registry and repository until they expire
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]bearerToken
+}
+
+// get returns a token that is still valid at now
+func (c *tokenCache) get(key string, now time.Time) (bearerToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok || !now.Before(token.expiresAt) {
+		return bearerToken{}, false
+	}
+	return token, true
+}
+
+// set stores a token for key
+func (c *tokenCache) set(key string, token bearerToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tokens == nil {
+		c.tokens = map[string]bearerToken{}
+	}
+	c.tokens[key] = token
+}
+
+// SetRegistryCredentials sets the credentials used to authenticate with a
+// registry host; they take precedence over the credentials provider
+func (s *HELMService) SetRegistryCredentials(registry string, creds config.Credentials) {
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+
+	s.credentials[registry] = creds
+}
+
+// SetCredentialsProvider sets the provider used to look up registry credentials
+func (s *HELMService) SetCredentialsProvider(provider CredentialsProvider) {
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+
+	s.credentialsProvider = provider
+}
+
+// registryCredentials returns the credentials configured for a registry host
+func (s *HELMService) registryCredentials(ctx context.Context, registry string) (config.Credentials, bool, error) {
+	s.credentialsMu.RLock()
+	creds, ok := s.credentials[registry]
+	provider := s.credentialsProvider
+	s.credentialsMu.RUnlock()
+
+	if ok || provider == nil {
+		return creds, ok, nil
+	}
+	return provider.Lookup(ctx, registry)
+}
+
+// doRegistryRequest sends a request to a registry, answering Bearer and Basic
+// authentication challenges and retrying once with the obtained credentials.
+// Credentials are only looked up once the registry asks for them, and Bearer
+// tokens are cached per registry and repository until they expire.
+// Requests count against the quota of the credential they are sent with.
+func (s *HELMService) doRegistryRequest(req *http.Request, registry, repository string) (*http.Response, error) {
+	cacheKey := registry + "/" + repository
+	key := quotaKey{registry: registry, credential: anonymousCredential}
+	if token, ok := s.tokens.get(cacheKey, s.now()); ok {
+		req.Header.Set("Authorization", "Bearer "+token.value)
+		key.credential = token.credential
+	}
+
+	resp, err := s.sendRegistryRequest(req, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	header := resp.Header.Get("WWW-Authenticate")
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if header == "" {
+		return nil, &statusError{fmt.Sprintf("registry %s returned 401 without an authentication challenge", registry), http.StatusUnauthorized}
+	}
+	challenge, err := parseAuthChallenge(header)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing authentication challenge from %s: %w", registry, err)
+	}
+
+	creds, hasCreds, err := s.registryCredentials(req.Context(), registry)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up credentials for %s: %w", registry, err)
+	}
+	key.credential = credentialName(creds)
+
+	retry := req.Clone(req.Context())
+	switch {
+	case challenge.Scheme == "bearer" && creds.RegistryToken != "":
+		retry.Header.Set("Authorization", "Bearer "+creds.RegistryToken)
+	case challenge.Scheme == "bearer":
+		token, err := s.fetchBearerToken(req.Context(), registry, challenge, creds, repository)
+		if err != nil {
+			return nil, fmt.Errorf("error authenticating with %s: %w", registry, err)
+		}
+		s.tokens.set(cacheKey, token)
+		retry.Header.Set("Authorization", "Bearer "+token.value)
+	case challenge.Scheme == "basic":
+		if !hasCreds || creds.Username == "" {
+			return nil, &statusError{fmt.Sprintf("registry %s requires credentials", registry), http.StatusUnauthorized}
+		}
+		retry.SetBasicAuth(creds.Username, creds.Password)
+	default:
+		return nil, fmt.Errorf("unsupported authentication scheme %q from %s", challenge.Scheme, registry)
+	}
+
+	return s.sendRegistryRequest(retry, key)
+}
+
+// fetchBearerToken requests a token from the realm of a Bearer challenge.
+// Identity tokens are exchanged with an OAuth2 refresh_token grant; otherwise
+// the token is requested anonymously or with basic credentials.
+func (s *HELMService) fetchBearerToken(ctx context.Context, registry string, challenge authChallenge, creds config.Credentials, repository string) (bearerToken, error) {
+	realm := challenge.Parameters["realm"]
+	if realm == "" {
+		return bearerToken{}, fmt.Errorf("bearer challenge has no realm")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return bearerToken{}, fmt.Errorf("invalid token realm %q: %w", realm, err)
+	}
+
+	scope := challenge.Parameters["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+
+	params := url.Values{}
+	if service := challenge.Parameters["service"]; service != "" {
+		params.Set("service", service)
+	}
+	params.Set("scope", scope)
+
+	var req *http.Request
+	if creds.IdentityToken != "" {
+		params.Set("grant_type", "refresh_token")
+		params.Set("refresh_token", creds.IdentityToken)
+		params.Set("client_id", oauthClientID)
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, tokenURL.String(), strings.NewReader(params.Encode()))
+		if err != nil {
+			return bearerToken{}, fmt.Errorf("error creating token request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := tokenURL.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		tokenURL.RawQuery = query.Encode()
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return bearerToken{}, fmt.Errorf("error creating token request: %w", err)
+		}
+		if creds.Username != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+	}
+
+	key := quotaKey{registry: registry, credential: credentialName(creds)}
+	resp, err := s.sendRegistryRequest(req, key)
+	if err != nil {
+		return bearerToken{}, fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return bearerToken{}, &statusError{fmt.Sprintf("error getting token: %s", resp.Status), resp.StatusCode}
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return bearerToken{}, fmt.Errorf("error parsing token response: %w", err)
+	}
+
+	token := result.Token
+	if token == "" {
+		token = result.AccessToken
+	}
+	if token == "" {
+		return bearerToken{}, fmt.Errorf("token response contains no token")
+	}
+
+	lifetime := defaultTokenLifetime
+	if result.ExpiresIn > 0 {
+		lifetime = time.Duration(result.ExpiresIn) * time.Second
+	}
+
+	return bearerToken{
+		value:      token,
+		credential: key.credential,
+		expiresAt:  s.now().Add(lifetime - tokenExpiryMargin),
+	}, nil
+}
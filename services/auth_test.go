@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	challenge, err := parseAuthChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	require.NoError(t, err)
+	require.Equal(t, "bearer", challenge.Scheme)
+	require.Equal(t, "https://auth.docker.io/token", challenge.Parameters["realm"])
+	require.Equal(t, "registry.docker.io", challenge.Parameters["service"])
+	require.Equal(t, "repository:library/nginx:pull,push", challenge.Parameters["scope"])
+
+	challenge, err = parseAuthChallenge(`Basic realm=registry`)
+	require.NoError(t, err)
+	require.Equal(t, "basic", challenge.Scheme)
+	require.Equal(t, "registry", challenge.Parameters["realm"])
+
+	_, err = parseAuthChallenge(`Bearer realm="unterminated`)
+	require.Error(t, err)
+}
+
+// newFakeTokenRegistry creates a token server and a registry that only serves
+// manifests to requests carrying a token issued by it. When username is set the
+// token server requires matching basic credentials.
+func newFakeTokenRegistry(t *testing.T, username, password string, expiresIn int) (*httptest.Server, *httptest.Server, *int32) {
+	t.Helper()
+
+	var issued int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username != "" {
+			u, p, ok := r.BasicAuth()
+			if !ok || u != username || p != password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		require.Equal(t, "fake-registry", r.URL.Query().Get("service"))
+		require.Equal(t, "repository:library/nginx:pull", r.URL.Query().Get("scope"))
+
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("token-%d", n),
+			"expires_in": expiresIn,
+		})
+	}))
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="fake-registry",scope="repository:library/nginx:pull"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "layers": [{"digest": "sha256:a", "size": 1}]}`))
+	}))
+
+	return tokenServer, registry, &issued
+}
+
+func TestDoRegistryRequest_AnonymousBearer(t *testing.T) {
+	tokenServer, registry, issued := newFakeTokenRegistry(t, "", "", 300)
+	defer tokenServer.Close()
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	layers, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+
+	// The cached token is reused for the second request
+	_, err = service.GetImageLayers(context.Background(), "nginx:1.25")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(issued))
+}
+
+func TestDoRegistryRequest_TokenExpiry(t *testing.T) {
+	tokenServer, registry, issued := newFakeTokenRegistry(t, "", "", 60)
+	defer tokenServer.Close()
+	defer registry.Close()
+
+	now := time.Now()
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.now = func() time.Time { return now }
+
+	_, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(issued))
+}
+
+func TestDoRegistryRequest_BearerWithCredentials(t *testing.T) {
+	tokenServer, registry, _ := newFakeTokenRegistry(t, "user", "secret", 300)
+	defer tokenServer.Close()
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	_, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.Error(t, err)
+
+	service.SetRegistryCredentials("docker.io", config.Credentials{Username: "user", Password: "secret"})
+	layers, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+}
+
+func TestDoRegistryRequest_Basic(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != "user" || p != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "layers": [{"digest": "sha256:a", "size": 1}]}`))
+	}))
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	service := NewHELMService()
+	service.SetInsecureRegistries(host)
+
+	_, err := service.GetImageLayers(context.Background(), host+"/team/app:1.0")
+	require.Error(t, err)
+
+	service.SetRegistryCredentials(host, config.Credentials{Username: "user", Password: "secret"})
+	layers, err := service.GetImageLayers(context.Background(), host+"/team/app:1.0")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+}
+
+// fakeCredentialsProvider returns fixed credentials per registry
+type fakeCredentialsProvider map[string]config.Credentials
+
+func (p fakeCredentialsProvider) Lookup(ctx context.Context, registry string) (config.Credentials, bool, error) {
+	creds, ok := p[registry]
+	return creds, ok, nil
+}
+
+func TestDoRegistryRequest_CredentialsProvider(t *testing.T) {
+	tokenServer, registry, _ := newFakeTokenRegistry(t, "user", "secret", 300)
+	defer tokenServer.Close()
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetCredentialsProvider(fakeCredentialsProvider{
+		"docker.io": {Username: "user", Password: "secret"},
+	})
+
+	layers, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+}
+
+func TestDoRegistryRequest_IdentityToken(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		if r.PostForm.Get("refresh_token") != "identity" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-oauth"})
+	}))
+	defer tokenServer.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-oauth" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "layers": [{"digest": "sha256:a", "size": 1}]}`))
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetRegistryCredentials("docker.io", config.Credentials{IdentityToken: "identity"})
+
+	layers, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+}
+
+func TestDoRegistryRequest_RegistryToken(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer static-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://unused.invalid/token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "layers": [{"digest": "sha256:a", "size": 1}]}`))
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetRegistryCredentials("docker.io", config.Credentials{RegistryToken: "static-token"})
+
+	layers, err := service.GetImageLayers(context.Background(), "nginx:latest")
+	require.NoError(t, err)
+	require.Equal(t, 1, layers)
+}
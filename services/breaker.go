@@ -0,0 +1,179 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"helm-viewer/models"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitOpenError is returned without contacting a registry whose circuit
+// breaker is open
+type circuitOpenError struct {
+	registry string
+	until    time.Time
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("registry %s is unavailable, retrying after %s", e.registry, e.until.Format(time.RFC3339))
+}
+
+// circuitBreakers tracks the health of every registry: after threshold
+// consecutive failures a registry's circuit opens and its requests fail fast
+// for the cooldown, after which one trial request decides whether it closes
+// again or stays open for another cooldown
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*circuitBreaker
+}
+
+// circuitBreaker is the state and request counts of one registry
+type circuitBreaker struct {
+	state     string
+	failures  int // consecutive
+	openUntil time.Time
+	trial     bool // a half-open trial request is in flight
+
+	requests int64
+	retries  int64
+	errors   int64
+	trips    int64
+}
+
+// newCircuitBreakers creates circuit breakers with the given settings
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  map[string]*circuitBreaker{},
+	}
+}
+
+// get returns the breaker of a registry; the lock must be held
+func (b *circuitBreakers) get(registry string) *circuitBreaker {
+	breaker, ok := b.breakers[registry]
+	if !ok {
+		breaker = &circuitBreaker{state: circuitClosed}
+		b.breakers[registry] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether a request to a registry may be sent
+func (b *circuitBreakers) allow(registry string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.get(registry)
+	if breaker.state == circuitOpen && !now.Before(breaker.openUntil) {
+		breaker.state = circuitHalfOpen
+	}
+	switch {
+	case breaker.state == circuitOpen, breaker.state == circuitHalfOpen && breaker.trial:
+		return &circuitOpenError{registry: registry, until: breaker.openUntil}
+	case breaker.state == circuitHalfOpen:
+		breaker.trial = true
+	}
+	breaker.requests++
+	return nil
+}
+
+// retried counts a retry of a request to a registry
+func (b *circuitBreakers) retried(registry string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.get(registry).retries++
+}
+
+// abandon ends a request to a registry without an outcome
+func (b *circuitBreakers) abandon(registry string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.get(registry).trial = false
+}
+
+// record updates the breaker of a registry with the outcome of a request
+func (b *circuitBreakers) record(registry string, success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.get(registry)
+	breaker.trial = false
+	if success {
+		breaker.state = circuitClosed
+		breaker.failures = 0
+		return
+	}
+
+	breaker.errors++
+	breaker.failures++
+	if breaker.state == circuitHalfOpen || breaker.failures >= b.threshold {
+		if breaker.state != circuitOpen {
+			breaker.trips++
+		}
+		breaker.state = circuitOpen
+		breaker.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// stats returns the state and counts of the breakers of registries, or of
+// every registry seen when none are given, sorted by registry
+func (b *circuitBreakers) stats(registries ...string) []models.RegistryStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(registries) == 0 {
+		for registry := range b.breakers {
+			registries = append(registries, registry)
+		}
+	}
+	sort.Strings(registries)
+
+	stats := []models.RegistryStats{}
+	for _, registry := range registries {
+		breaker, ok := b.breakers[registry]
+		if !ok {
+			continue
+		}
+		stat := models.RegistryStats{
+			Registry: registry,
+			Circuit:  breaker.state,
+			Requests: breaker.requests,
+			Retries:  breaker.retries,
+			Errors:   breaker.errors,
+			Trips:    breaker.trips,
+		}
+		if breaker.state != circuitClosed {
+			openUntil := breaker.openUntil
+			stat.OpenUntil = &openUntil
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// SetCircuitBreaker sets the number of consecutive failures that open the
+// circuit of a registry and how long it stays open
+func (s *HELMService) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	s.breakers = newCircuitBreakers(threshold, cooldown)
+}
+
+// RegistryStats returns the circuit breaker state and request counts of
+// registries, or of every registry contacted when none are given
+func (s *HELMService) RegistryStats(registries ...string) []models.RegistryStats {
+	return s.breakers.stats(registries...)
+}
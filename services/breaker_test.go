@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Now()
+	breakers := newCircuitBreakers(2, time.Minute)
+
+	require.NoError(t, breakers.allow("ghcr.io", now))
+	breakers.record("ghcr.io", false, now)
+	require.NoError(t, breakers.allow("ghcr.io", now))
+	breakers.record("ghcr.io", false, now)
+
+	// Two consecutive failures open the circuit
+	var open *circuitOpenError
+	require.ErrorAs(t, breakers.allow("ghcr.io", now), &open)
+	require.NoError(t, breakers.allow("docker.io", now))
+
+	stats := breakers.stats("ghcr.io")
+	require.Len(t, stats, 1)
+	require.Equal(t, circuitOpen, stats[0].Circuit)
+	require.Equal(t, now.Add(time.Minute), *stats[0].OpenUntil)
+	require.Equal(t, int64(1), stats[0].Trips)
+
+	// After the cooldown a single trial request goes through
+	now = now.Add(time.Minute)
+	require.NoError(t, breakers.allow("ghcr.io", now))
+	require.Error(t, breakers.allow("ghcr.io", now))
+
+	// A failed trial opens the circuit again
+	breakers.record("ghcr.io", false, now)
+	require.Error(t, breakers.allow("ghcr.io", now))
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	require.NoError(t, breakers.allow("ghcr.io", now))
+	breakers.record("ghcr.io", true, now)
+	require.NoError(t, breakers.allow("ghcr.io", now))
+	require.NoError(t, breakers.allow("ghcr.io", now))
+
+	stats = breakers.stats()
+	require.Len(t, stats, 2)
+	require.Equal(t, "docker.io", stats[0].Registry)
+	require.Equal(t, circuitClosed, stats[1].Circuit)
+	require.Nil(t, stats[1].OpenUntil)
+	require.Equal(t, int64(2), stats[1].Trips)
+}
+
+func TestGetImageInfo_CircuitBreaker(t *testing.T) {
+	var requests int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetRetryPolicy(1, 0, 0)
+	service.SetCircuitBreaker(2, time.Minute)
+
+	for _, name := range []string{"nginx:1.0", "redis:1.0"} {
+		_, _, err := service.GetImageInfo(context.Background(), name)
+		require.Error(t, err)
+	}
+
+	_, _, err := service.GetImageInfo(context.Background(), "postgres:1.0")
+	var imageErr *models.ImageError
+	require.ErrorAs(t, err, &imageErr)
+	require.Equal(t, models.ImageErrorCircuitOpen, imageErr.Code)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	require.Equal(t, "open", service.RegistryStats("docker.io")[0].Circuit)
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+)
+
+// CacheBackend stores image metadata cache entries by key
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte) error
+}
+
+// imageCache caches image metadata in a backend: images by digest forever,
+// as digests are immutable, and the digests of tags until their TTL expires
+type imageCache struct {
+	backend CacheBackend
+	tagTTL  time.Duration
+	hits    int64
+	misses  int64
+}
+
+// cachedImage is the metadata of an image digest, fetched from the registry
+// at Fetched; Details are only set by detailed lookups
+type cachedImage struct {
+	Size    int64          `json:"size"`
+	Layers  int            `json:"layers"`
+	Fetched time.Time      `json:"fetched"`
+	Details *cachedDetails `json:"details,omitempty"`
+}
+
+// cachedDetails are the manifest and configuration details of an image digest
+type cachedDetails struct {
+	Digest         string                 `json:"digest"`
+	ManifestDigest string                 `json:"manifestDigest"`
+	MediaType      string                 `json:"mediaType"`
+	Platform       string                 `json:"platform,omitempty"`
+	Created        *time.Time             `json:"created,omitempty"`
+	Layers         []models.LayerMetadata `json:"layers,omitempty"`
+}
+
+// cachedLayer is the uncompressed size of a layer
+type cachedLayer struct {
+	Uncompressed int64 `json:"uncompressed"`
+}
+
+// cachedTag is the digest a tag resolved to
+type cachedTag struct {
+	Digest  string    `json:"digest"`
+	Expires time.Time `json:"expires"`
+}
+
+// tagKey is the cache key of the digest of a tag
+func tagKey(ref reference.Reference) string {
+	return "tag:" + ref.Registry + "/" + ref.Path() + ":" + ref.Tag
+}
+
+// imageKey is the cache key of the metadata of a digest; index digests
+// resolve to a different image per platform
+func imageKey(ref reference.Reference, digest string, p platform) string {
+	return "image:" + ref.Registry + "/" + ref.Path() + "@" + digest + " " + p.String()
+}
+
+// layerKey is the cache key of the uncompressed size of a layer; layers are
+// content-addressed, so the key does not depend on the repository
+func layerKey(digest string) string {
+	return "layer:" + digest
+}
+
+// get returns the cached metadata of an image, resolving tags through
+// their cached digest
+func (c *imageCache) get(ref reference.Reference, p platform, now time.Time) (cachedImage, bool) {
+	digest := ref.Digest
+	if digest == "" {
+		var tag cachedTag
+		if !c.load(tagKey(ref), &tag) || !now.Before(tag.Expires) {
+			atomic.AddInt64(&c.misses, 1)
+			return cachedImage{}, false
+		}
+		digest = tag.Digest
+	}
+
+	var image cachedImage
+	if !c.load(imageKey(ref, digest, p), &image) {
+		atomic.AddInt64(&c.misses, 1)
+		return cachedImage{}, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return image, true
+}
+
+// set caches the metadata of the image digest a reference resolved to and,
+// for tags, the digest itself
+func (c *imageCache) set(ref reference.Reference, digest string, p platform, image cachedImage, now time.Time) {
+	c.store(imageKey(ref, digest, p), image)
+	if ref.Digest == "" && ref.Tag != "" {
+		c.store(tagKey(ref), cachedTag{Digest: digest, Expires: now.Add(c.tagTTL)})
+	}
+}
+
+// getLayer returns the cached uncompressed size of a layer
+func (c *imageCache) getLayer(digest string) (int64, bool) {
+	var layer cachedLayer
+	if !c.load(layerKey(digest), &layer) {
+		return 0, false
+	}
+	return layer.Uncompressed, true
+}
+
+// setLayer caches the uncompressed size of a layer
+func (c *imageCache) setLayer(digest string, uncompressed int64) {
+	c.store(layerKey(digest), cachedLayer{Uncompressed: uncompressed})
+}
+
+func (c *imageCache) load(key string, v any) bool {
+	data, ok := c.backend.Get(key)
+	return ok && json.Unmarshal(data, v) == nil
+}
+
+// store writes an entry; failing writes only cost a later cache miss
+func (c *imageCache) store(key string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		c.backend.Set(key, data)
+	}
+}
+
+// stats returns the hit and miss counts
+func (c *imageCache) stats() models.CacheStats {
+	return models.CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+	}
+}
+
+// SetCache sets the backend of the image metadata cache and how long the
+// digests of tags are cached
+func (s *HELMService) SetCache(backend CacheBackend, tagTTL time.Duration) {
+	s.cache = &imageCache{backend: backend, tagTTL: tagTTL}
+}
+
+// CacheStats returns the hit and miss counts of the image metadata cache
+func (s *HELMService) CacheStats() models.CacheStats {
+	return s.cache.stats()
+}
+
+// MemoryCache is an in-memory CacheBackend evicting the least recently used
+// entries beyond its capacity
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+}
+
+// memoryCacheEntry is an entry of a MemoryCache
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache creates a MemoryCache holding up to capacity entries
+func NewMemoryCache(capacity int) *MemoryCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &MemoryCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Get returns the value of a key
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryCacheEntry).value, true
+}
+
+// Set stores the value of a key
+func (c *MemoryCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryCacheEntry).value = value
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
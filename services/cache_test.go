@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/config"
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	require.NoError(t, cache.Set("a", []byte("1")))
+	require.NoError(t, cache.Set("b", []byte("2")))
+
+	// Reading "a" makes "b" the least recently used entry
+	value, ok := cache.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), value)
+
+	require.NoError(t, cache.Set("c", []byte("3")))
+	_, ok = cache.Get("b")
+	require.False(t, ok)
+	_, ok = cache.Get("a")
+	require.True(t, ok)
+	_, ok = cache.Get("c")
+	require.True(t, ok)
+}
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache, err := NewDiskCache(path)
+	require.NoError(t, err)
+	require.NoError(t, cache.Set("a", []byte("1")))
+	require.NoError(t, cache.Close())
+
+	cache, err = NewDiskCache(path)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	value, ok := cache.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), value)
+	_, ok = cache.Get("b")
+	require.False(t, ok)
+}
+
+func TestGetImageInfo_Cache(t *testing.T) {
+	manifest := `{"schemaVersion": 2, "mediaType": "` + mediaTypeOCIManifest + `", "layers": [{"digest": "sha256:a", "size": 1024}]}`
+
+	var requests int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch strings.TrimPrefix(r.URL.Path, "/v2/library/nginx/manifests/") {
+		case "1.25", digestFor("1"):
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Header().Set("Docker-Content-Digest", digestFor("1"))
+			w.Write([]byte(manifest))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	for name, backend := range map[string]func(t *testing.T) CacheBackend{
+		"memory": func(t *testing.T) CacheBackend { return NewMemoryCache(config.DefaultCacheSize) },
+		"disk": func(t *testing.T) CacheBackend {
+			cache, err := NewDiskCache(filepath.Join(t.TempDir(), "cache.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { cache.Close() })
+			return cache
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+
+			now := time.Now()
+			service := NewHELMService()
+			service.SetRegistryBaseURL(registry.URL)
+			service.SetCache(backend(t), time.Minute)
+			service.now = func() time.Time { return now }
+
+			lookup := func(name string) {
+				t.Helper()
+				size, layers, err := service.GetImageInfo(context.Background(), name)
+				require.NoError(t, err)
+				require.Equal(t, "1.00 KB", size)
+				require.Equal(t, 1, layers)
+			}
+
+			// The tag is resolved once, and its digest is cached with the tag
+			lookup("nginx:1.25")
+			lookup("nginx:1.25")
+			lookup("nginx@" + digestFor("1"))
+			require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+			require.Equal(t, models.CacheStats{Hits: 2, Misses: 1}, service.CacheStats())
+
+			// Expired tags are resolved again, digests are cached for good
+			now = now.Add(2 * time.Minute)
+			lookup("nginx@" + digestFor("1"))
+			require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+			lookup("nginx:1.25")
+			require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+			// Failures are not cached
+			_, _, err := service.GetImageInfo(context.Background(), "nginx:0.0")
+			require.Error(t, err)
+			_, _, err = service.GetImageInfo(context.Background(), "nginx:0.0")
+			require.Error(t, err)
+			require.Equal(t, int32(4), atomic.LoadInt32(&requests))
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"helm-viewer/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Limits applied when unpacking chart archives
+const (
+	maxDownloadSize     = 20 << 20  // compressed archive or YAML document
+	maxUnpackedSize     = 100 << 20 // all files of an archive, including subcharts
+	maxUnpackedFileSize = 5 << 20   // a single file of an archive
+	maxArchiveFiles     = 5000      // entries of an archive, including subcharts
+	maxSubchartDepth    = 5         // nesting of subcharts under charts/
+)
+
+// chartImagesAnnotation lists the images of a chart in Chart.yaml (Artifact Hub convention)
+const chartImagesAnnotation = "artifacthub.io/images"
+
+// templateImageRegexp matches "image: value" lines in chart templates
+var templateImageRegexp = regexp.MustCompile(`^\s*(?:-\s+)?image:\s*["']?([^"'\s#]+)["']?\s*(?:#.*)?$`)
+
+// isGzip reports whether data starts with the gzip magic number
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// chartMetadata is the content of Chart.yaml, exposed to templates as .Chart
+type chartMetadata struct {
+	APIVersion   string            `yaml:"apiVersion"`
+	Name         string            `yaml:"name"`
+	Version      string            `yaml:"version"`
+	AppVersion   string            `yaml:"appVersion"`
+	Description  string            `yaml:"description"`
+	Type         string            `yaml:"type"`
+	KubeVersion  string            `yaml:"kubeVersion"`
+	Home         string            `yaml:"home"`
+	Icon         string            `yaml:"icon"`
+	Keywords     []string          `yaml:"keywords"`
+	Annotations  map[string]string `yaml:"annotations"`
+	Dependencies []chartDependency `yaml:"dependencies"`
+}
+
+// chartDependency is a subchart declared in Chart.yaml
+type chartDependency struct {
+	Name       string   `yaml:"name"`
+	Version    string   `yaml:"version"`
+	Repository string   `yaml:"repository"`
+	Condition  string   `yaml:"condition"`
+	Tags       []string `yaml:"tags"`
+	Alias      string   `yaml:"alias"`
+}
+
+// chart is an unpacked chart with its bundled subcharts
+type chart struct {
+	// source is the path of the chart directory used in document sources,
+	// e.g. "mychart" or "mychart/charts/redis-1.0.0.tgz/redis"
+	source    string
+	metadata  chartMetadata
+	files     map[string][]byte // relative to the chart directory, without charts/
+	subcharts []*chart
+}
+
+// archiveBudget tracks the remaining unpack limits across nested archives
+type archiveBudget struct {
+	bytes int64
+	files int
+}
+
+// parseChartArchive unpacks a gzip tar chart archive in memory, including the
+// subcharts bundled under charts/ as directories or archives; unpacking stops
+// once ctx is done
+func parseChartArchive(ctx context.Context, data []byte) (*chart, error) {
+	budget := &archiveBudget{bytes: maxUnpackedSize, files: maxArchiveFiles}
+	return unpackChartArchive(ctx, data, "", 0, budget)
+}
+
+// loadChartArchive unpacks a chart archive, coalesces the user values with the
+// chart defaults and returns the documents to discover images in: the
+// manifests rendered from its templates when opts.Render is set, or else the
+// files that may reference images of the chart and its enabled subcharts.
+// Unpacking and rendering stop once ctx is done.
+func loadChartArchive(ctx context.Context, data []byte, values map[string]any, opts models.LoadOptions) ([]models.YAMLDocument, error) {
+	c, err := parseChartArchive(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := chartValues(c)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := collectRenderTargets(c, c.metadata.Name, "", coalesceValues(deepCopyMap(values), defaults))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Render {
+		return renderChart(ctx, targets, opts)
+	}
+
+	var docs []models.YAMLDocument
+	for _, target := range targets {
+		targetDocs, err := target.documents()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, targetDocs...)
+	}
+	return docs, nil
+}
+
+// unpackChartArchive unpacks one archive level; prefix is prepended to the
+// source path of the chart to identify nested subchart archives. Every entry
+// counts against the budget, as its data is decompressed even when skipped.
+func unpackChartArchive(ctx context.Context, data []byte, prefix string, depth int, budget *archiveBudget) (*chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+
+		if budget.files--; budget.files < 0 {
+			return nil, fmt.Errorf("chart archive has more than %d files", maxArchiveFiles)
+		}
+
+		name, err := sanitizeArchivePath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Size > maxUnpackedFileSize {
+			return nil, fmt.Errorf("chart file %s exceeds %d bytes", name, maxUnpackedFileSize)
+		}
+		if budget.bytes -= hdr.Size; budget.bytes < 0 {
+			return nil, fmt.Errorf("chart archive exceeds %d bytes unpacked", maxUnpackedSize)
+		}
+		// Directories, links and special files are never read
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart file %s: %w", name, err)
+		}
+		files[name] = content
+	}
+
+	root := chartRoot(files)
+	chartFiles := map[string][]byte{}
+	for name, content := range files {
+		if root == "" {
+			chartFiles[name] = content
+		} else if strings.HasPrefix(name, root+"/") {
+			chartFiles[strings.TrimPrefix(name, root+"/")] = content
+		}
+	}
+	if chartFiles["Chart.yaml"] == nil && chartFiles["values.yaml"] == nil {
+		return nil, fmt.Errorf("chart archive contains no Chart.yaml or values.yaml")
+	}
+
+	return newChart(ctx, path.Join(prefix, root), chartFiles, depth, budget)
+}
+
+// chartRoot returns the chart directory of an archive: the directory of the
+// top-most Chart.yaml, or the directory shared by all entries
+func chartRoot(files map[string][]byte) string {
+	root, found := "", false
+	for name := range files {
+		if path.Base(name) != "Chart.yaml" {
+			continue
+		}
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		}
+		if !found || strings.Count(dir, "/") < strings.Count(root, "/") {
+			root, found = dir, true
+		}
+	}
+	if found {
+		return root
+	}
+
+	for name := range files {
+		top, _, ok := strings.Cut(name, "/")
+		if !ok || (found && top != root) {
+			return ""
+		}
+		root, found = top, true
+	}
+	return root
+}
+
+// newChart builds a chart from the files of its directory; files under
+// charts/ become subcharts
+func newChart(ctx context.Context, source string, files map[string][]byte, depth int, budget *archiveBudget) (*chart, error) {
+	c := &chart{source: source, files: map[string][]byte{}}
+	subchartDirs := map[string]map[string][]byte{}
+	var subchartArchives []string
+
+	for name, content := range files {
+		if !strings.HasPrefix(name, "charts/") {
+			c.files[name] = content
+			continue
+		}
+
+		dir, rest, nested := strings.Cut(strings.TrimPrefix(name, "charts/"), "/")
+		switch {
+		case nested:
+			if subchartDirs[dir] == nil {
+				subchartDirs[dir] = map[string][]byte{}
+			}
+			subchartDirs[dir][rest] = content
+		case strings.HasSuffix(dir, ".tgz"):
+			subchartArchives = append(subchartArchives, dir)
+		}
+	}
+
+	if metadata, ok := c.files["Chart.yaml"]; ok {
+		if err := yaml.Unmarshal(metadata, &c.metadata); err != nil {
+			return nil, fmt.Errorf("invalid Chart.yaml in %s: %w", source, err)
+		}
+	}
+	if c.metadata.Name == "" {
+		c.metadata.Name = path.Base(source)
+	}
+
+	if (len(subchartDirs) > 0 || len(subchartArchives) > 0) && depth >= maxSubchartDepth {
+		return nil, fmt.Errorf("subcharts of %s are nested deeper than %d levels", source, maxSubchartDepth)
+	}
+
+	dirs := make([]string, 0, len(subchartDirs))
+	for dir := range subchartDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		sub, err := newChart(ctx, path.Join(source, "charts", dir), subchartDirs[dir], depth+1, budget)
+		if err != nil {
+			return nil, err
+		}
+		c.subcharts = append(c.subcharts, sub)
+	}
+
+	sort.Strings(subchartArchives)
+	for _, archive := range subchartArchives {
+		archiveSource := path.Join(source, "charts", archive)
+		sub, err := unpackChartArchive(ctx, files["charts/"+archive], archiveSource, depth+1, budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack subchart %s: %w", archiveSource, err)
+		}
+		c.subcharts = append(c.subcharts, sub)
+	}
+
+	return c, nil
+}
+
+// sanitizeArchivePath cleans an archive entry name and rejects absolute paths
+// and paths escaping the archive root
+func sanitizeArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("chart archive entry %q escapes the archive root", name)
+	}
+	return cleaned, nil
+}
+
+// sourcePath returns the document source of a chart file
+func (c *chart) sourcePath(name string) string {
+	return path.Join(c.source, name)
+}
+
+// isTemplate reports whether a chart file is a template
+func isTemplate(name string) bool {
+	if !strings.HasPrefix(name, "templates/") {
+		return false
+	}
+	ext := path.Ext(name)
+	return ext == ".yaml" || ext == ".yml" || ext == ".tpl"
+}
+
+// sortedFileNames returns the names of the chart files in lexical order
+func (c *chart) sortedFileNames() []string {
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// documents converts the chart files that may reference images into content
+// for FindContainerImages. The coalesced values stand in for the values file,
+// without the sections of subcharts, which get documents of their own.
+// Chart.yaml contributes the images listed in its artifacthub.io/images
+// annotation, and templates contribute their literal "image:" lines, since
+// they cannot be parsed before rendering.
+func (t renderTarget) documents() ([]models.YAMLDocument, error) {
+	c := t.chart
+
+	values := make(map[string]any, len(t.values))
+	for key, value := range t.values {
+		values[key] = value
+	}
+	for _, key := range t.subchartKeys {
+		delete(values, key)
+	}
+
+	var docs []models.YAMLDocument
+	if len(values) > 0 {
+		doc := models.YAMLDocument{
+			Source:       c.sourcePath(c.valuesFileName()),
+			Chart:        c.metadata.Name,
+			Values:       true,
+			ValuesPrefix: t.valuesPrefix,
+			Content:      values,
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(c.files[c.valuesFileName()], &node); err == nil {
+			doc.Node = &node
+		}
+		docs = append(docs, doc)
+	}
+
+	for _, name := range c.sortedFileNames() {
+		var content any
+		switch {
+		case name == "Chart.yaml":
+			images, err := annotatedImages(c.metadata)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse chart file %s: %w", c.sourcePath(name), err)
+			}
+			content = images
+		case isTemplate(name):
+			if images := extractTemplateImages(c.files[name]); images != nil {
+				content = images
+			}
+		default:
+			continue
+		}
+
+		if content != nil {
+			docs = append(docs, models.YAMLDocument{Source: c.sourcePath(name), Chart: c.metadata.Name, Content: content})
+		}
+	}
+
+	return docs, nil
+}
+
+// annotatedImages returns the images annotated in Chart.yaml, if any
+func annotatedImages(metadata chartMetadata) (any, error) {
+	annotation := metadata.Annotations[chartImagesAnnotation]
+	if annotation == "" {
+		return nil, nil
+	}
+
+	var images []any
+	if err := yaml.Unmarshal([]byte(annotation), &images); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", chartImagesAnnotation, err)
+	}
+	return images, nil
+}
+
+// extractTemplateImages finds literal image references in a template; values
+// built from template actions are skipped. The images are returned as a
+// sequence of {image: name} maps positioned at their template lines.
+func extractTemplateImages(content []byte) *yaml.Node {
+	images := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		match := templateImageRegexp.FindStringSubmatchIndex(text)
+		if match == nil || strings.Contains(text[match[2]:match[3]], "{{") {
+			continue
+		}
+
+		column := strings.Index(text, "image:") + 1
+		images.Content = append(images.Content, &yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "image", Line: line, Column: column},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: text[match[2]:match[3]], Line: line, Column: match[2] + 1},
+			},
+		})
+	}
+
+	if len(images.Content) == 0 {
+		return nil
+	}
+	return images
+}
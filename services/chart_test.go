@@ -0,0 +1,162 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildChartArchive creates a gzip tar archive from file names and contents
+func buildChartArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestLoadChartArchive(t *testing.T) {
+	subchart := buildChartArchive(t, map[string]string{
+		"redis/values.yaml": "image:\n  repository: redis\n  tag: \"7.2\"\n",
+	})
+
+	archive := buildChartArchive(t, map[string]string{
+		"mychart/Chart.yaml": `
+name: mychart
+annotations:
+  artifacthub.io/images: |
+    - name: app
+      image: ghcr.io/org/app:1.0
+`,
+		"mychart/values.yaml": "image:\n  repository: nginx\n  tag: \"1.25\"\n",
+		"mychart/templates/job.yaml": `
+spec:
+  containers:
+    - name: migrate
+      image: "busybox:1.36"
+    - name: app
+      image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`,
+		"mychart/templates/NOTES.txt":    "image: ignored:1.0",
+		"mychart/charts/redis-1.0.0.tgz": string(subchart),
+	})
+
+	docs, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{})
+	require.NoError(t, err)
+
+	service := NewHELMService()
+	found := map[string]string{}
+	located := map[string]string{}
+	for _, doc := range docs {
+		for _, image := range service.FindDocumentImages(doc) {
+			found[image.Name] = image.Source
+			located[image.Name] = fmt.Sprintf("%s:%d:%d %s", image.Path, image.Line, image.Column, image.Set)
+		}
+	}
+
+	require.Equal(t, map[string]string{
+		"ghcr.io/org/app:1.0": "mychart/Chart.yaml",
+		"nginx:1.25":          "mychart/values.yaml",
+		"busybox:1.36":        "mychart/templates/job.yaml",
+		"redis:7.2":           "mychart/charts/redis-1.0.0.tgz/redis/values.yaml",
+	}, found)
+
+	require.Equal(t, "image:1:1 image.repository=nginx,image.tag=1.25", located["nginx:1.25"])
+	require.Equal(t, "[0].image:5:7 ", located["busybox:1.36"])
+	require.Equal(t, "redis.image:1:1 redis.image.repository=redis,redis.image.tag=7.2", located["redis:7.2"])
+}
+
+func TestLoadChartArchive_Limits(t *testing.T) {
+	t.Run("path traversal", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{"../values.yaml": "image: nginx"})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{})
+		require.ErrorContains(t, err, "escapes the archive root")
+	})
+
+	t.Run("absolute path", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{"/etc/values.yaml": "image: nginx"})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("file too large", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/values.yaml": strings.Repeat("#", maxUnpackedFileSize+1),
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{})
+		require.ErrorContains(t, err, "exceeds")
+	})
+
+	t.Run("skipped entries count", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "mychart/data", Mode: 0o644, Size: maxUnpackedFileSize + 1, Typeflag: tar.TypeCont}))
+		_, err := tw.Write(make([]byte, maxUnpackedFileSize+1))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+
+		_, err = loadChartArchive(context.Background(), buf.Bytes(), nil, models.LoadOptions{})
+		require.ErrorContains(t, err, "exceeds")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		archive := buildChartArchive(t, map[string]string{"mychart/Chart.yaml": "name: mychart\n"})
+		_, err := loadChartArchive(ctx, archive, nil, models.LoadOptions{})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("no chart files", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{"README.md": "hello"})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		_, err := loadChartArchive(context.Background(), []byte{0x1f, 0x8b, 0x00}, nil, models.LoadOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestLoadAndParseYAML_ChartArchive(t *testing.T) {
+	archive := buildChartArchive(t, map[string]string{
+		"mychart/values.yaml": "image:\n  repository: nginx\n",
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	docs, err := service.LoadAndParseYAML(context.Background(), server.URL+"/mychart-1.2.3.tgz", models.LoadOptions{})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "mychart/values.yaml", docs[0].Source)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+)
+
+// maxConfigSize is the maximum size of an image configuration blob
+const maxConfigSize = 4 << 20
+
+// imageConfig holds the fields of an image configuration we report
+type imageConfig struct {
+	Created      *time.Time `json:"created"`
+	OS           string     `json:"os"`
+	Architecture string     `json:"architecture"`
+	Variant      string     `json:"variant"`
+}
+
+// imageDetails returns the details of a resolved manifest: digests, media
+// type and layers, and the platform and creation time of its configuration.
+// Schema 1 manifests have no configuration and no layer sizes.
+func (s *HELMService) imageDetails(ctx context.Context, ref reference.Reference, m *manifest) (*cachedDetails, error) {
+	details := &cachedDetails{
+		Digest:         m.imageDigest(),
+		ManifestDigest: m.digest,
+		MediaType:      m.MediaType,
+	}
+	if m.platform != nil {
+		details.Platform = m.platform.String()
+	}
+	for _, layer := range m.Layers {
+		details.Layers = append(details.Layers, models.LayerMetadata{
+			Digest:          layer.Digest,
+			MediaType:       layer.MediaType,
+			CompressedBytes: layer.Size,
+		})
+	}
+
+	if m.Config.Digest == "" {
+		return details, nil
+	}
+	body, err := s.getBlob(ctx, ref, m.Config.Digest, maxConfigSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image config: %w", err)
+	}
+	var config imageConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("error parsing image config: %w", err)
+	}
+
+	details.Created = config.Created
+	if details.Platform == "" && config.OS != "" && config.Architecture != "" {
+		details.Platform = platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}.String()
+	}
+	return details, nil
+}
+
+// measureUncompressed fills in the uncompressed size of the layers of an
+// image and their total; sizes that cannot be measured are left unknown, and
+// so is the total then
+func (s *HELMService) measureUncompressed(ctx context.Context, ref reference.Reference, metadata *models.ImageMetadata) {
+	if len(metadata.LayerDetails) == 0 {
+		return
+	}
+
+	var total int64
+	known := true
+	for i, layer := range metadata.LayerDetails {
+		size, err := s.uncompressedLayerSize(ctx, ref, layer)
+		if err != nil {
+			known = false
+			continue
+		}
+		metadata.LayerDetails[i].UncompressedBytes = &size
+		total += size
+	}
+	if known {
+		metadata.UncompressedBytes = &total
+	}
+}
+
+// uncompressedLayerSize returns the uncompressed size of a layer: tar layers
+// are their own size, gzip layers are downloaded and decompressed once, their
+// size being cached by digest
+func (s *HELMService) uncompressedLayerSize(ctx context.Context, ref reference.Reference, layer models.LayerMetadata) (int64, error) {
+	switch {
+	case strings.HasSuffix(layer.MediaType, ".tar"):
+		return layer.CompressedBytes, nil
+	case !strings.HasSuffix(layer.MediaType, "+gzip") && !strings.HasSuffix(layer.MediaType, ".tar.gzip"):
+		return 0, fmt.Errorf("unsupported layer media type %s", layer.MediaType)
+	}
+	if size, ok := s.cache.getLayer(layer.Digest); ok {
+		return size, nil
+	}
+
+	verifier, err := newDigestVerifier(layer.Digest)
+	if err != nil {
+		return 0, err
+	}
+	blob, err := s.openBlob(ctx, ref, layer.Digest)
+	if err != nil {
+		return 0, err
+	}
+	defer blob.Close()
+
+	compressed := io.TeeReader(blob, verifier)
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		return 0, fmt.Errorf("error decompressing layer %s: %w", layer.Digest, err)
+	}
+	size, err := io.Copy(io.Discard, gz)
+	if err != nil {
+		return 0, fmt.Errorf("error decompressing layer %s: %w", layer.Digest, err)
+	}
+	// Read what follows the gzip stream before checking the digest
+	if _, err := io.Copy(io.Discard, compressed); err != nil {
+		return 0, fmt.Errorf("error reading layer %s: %w", layer.Digest, err)
+	}
+	if err := verifier.verify(); err != nil {
+		return 0, err
+	}
+
+	s.cache.setLayer(layer.Digest, size)
+	return size, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sha256Digest returns the sha256 digest of content
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// gzipContent compresses content with gzip
+func gzipContent(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestGetImageMetadata_Details(t *testing.T) {
+	config := []byte(`{"created": "2024-03-01T10:00:00Z", "os": "linux", "architecture": "amd64"}`)
+	gzipLayer := gzipContent(t, bytes.Repeat([]byte("a"), 4096))
+	tarLayer := bytes.Repeat([]byte("b"), 1024)
+	zstdLayer := []byte("zstd")
+	blobs := map[string][]byte{
+		sha256Digest(config):    config,
+		sha256Digest(gzipLayer): gzipLayer,
+		sha256Digest(tarLayer):  tarLayer,
+		sha256Digest(zstdLayer): zstdLayer,
+	}
+
+	manifestBody := `{
+		"schemaVersion": 2,
+		"mediaType": "` + mediaTypeOCIManifest + `",
+		"config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "` + sha256Digest(config) + `", "size": 100},
+		"layers": [
+			{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": "` + sha256Digest(gzipLayer) + `", "size": ` + strconv.Itoa(len(gzipLayer)) + `},
+			{"mediaType": "application/vnd.oci.image.layer.v1.tar", "digest": "` + sha256Digest(tarLayer) + `", "size": 1024}
+		]
+	}`
+	manifestDigest := sha256Digest([]byte(manifestBody))
+	indexBody := `{
+		"schemaVersion": 2,
+		"mediaType": "` + mediaTypeOCIIndex + `",
+		"manifests": [{"digest": "` + manifestDigest + `", "platform": {"os": "linux", "architecture": "amd64"}}]
+	}`
+	zstdManifest := `{
+		"schemaVersion": 2,
+		"mediaType": "` + mediaTypeOCIManifest + `",
+		"config": {"digest": "` + sha256Digest(config) + `"},
+		"layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar+zstd", "digest": "` + sha256Digest(zstdLayer) + `", "size": 4}]
+	}`
+
+	var blobRequests, configRequests int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if digest := strings.TrimPrefix(r.URL.Path, "/v2/library/app/blobs/"); digest != r.URL.Path {
+			if digest == sha256Digest(config) {
+				atomic.AddInt32(&configRequests, 1)
+			} else {
+				atomic.AddInt32(&blobRequests, 1)
+			}
+			w.Write(blobs[digest])
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/library/app/manifests/1.0":
+			w.Header().Set("Content-Type", mediaTypeOCIIndex)
+			w.Write([]byte(indexBody))
+		case "/v2/library/app/manifests/" + manifestDigest:
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Write([]byte(manifestBody))
+		case "/v2/library/app/manifests/zstd":
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Write([]byte(zstdManifest))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	// Plain lookups do not read the image configuration
+	metadata, err := service.GetImageMetadata(context.Background(), "app:1.0", models.LookupOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(gzipLayer)+1024), metadata.Bytes)
+	require.Empty(t, metadata.Digest)
+	require.Zero(t, atomic.LoadInt32(&configRequests))
+
+	// Cached entries without details are fetched again for detailed lookups
+	metadata, err = service.GetImageMetadata(context.Background(), "app:1.0", models.LookupOptions{Details: true})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&configRequests))
+	require.Equal(t, sha256Digest([]byte(indexBody)), metadata.Digest)
+	require.Equal(t, manifestDigest, metadata.ManifestDigest)
+	require.Equal(t, mediaTypeOCIManifest, metadata.MediaType)
+	require.Equal(t, "linux/amd64", metadata.Platform)
+	require.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), *metadata.Created)
+	require.Equal(t, now, metadata.Fetched)
+	require.Equal(t, []models.LayerMetadata{
+		{Digest: sha256Digest(gzipLayer), MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", CompressedBytes: int64(len(gzipLayer))},
+		{Digest: sha256Digest(tarLayer), MediaType: "application/vnd.oci.image.layer.v1.tar", CompressedBytes: 1024},
+	}, metadata.LayerDetails)
+	require.Nil(t, metadata.UncompressedBytes)
+	require.Zero(t, atomic.LoadInt32(&blobRequests))
+
+	// Uncompressed sizes come from the cached details and are measured once;
+	// tar layers are not downloaded
+	for i := 0; i < 2; i++ {
+		metadata, err = service.GetImageMetadata(context.Background(), "app:1.0", models.LookupOptions{Uncompressed: true})
+		require.NoError(t, err)
+		require.Equal(t, int64(4096+1024), *metadata.UncompressedBytes)
+		require.Equal(t, int64(4096), *metadata.LayerDetails[0].UncompressedBytes)
+		require.Equal(t, int64(1024), *metadata.LayerDetails[1].UncompressedBytes)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&blobRequests))
+	require.Equal(t, int32(1), atomic.LoadInt32(&configRequests))
+
+	// Layers that cannot be measured leave the uncompressed size unknown
+	metadata, err = service.GetImageMetadata(context.Background(), "app:zstd", models.LookupOptions{Uncompressed: true})
+	require.NoError(t, err)
+	require.Equal(t, "linux/amd64", metadata.Platform)
+	require.Nil(t, metadata.UncompressedBytes)
+	require.Nil(t, metadata.LayerDetails[0].UncompressedBytes)
+}
+
+func TestUncompressedLayerSize_DigestMismatch(t *testing.T) {
+	layer := gzipContent(t, []byte("content"))
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(layer)
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	ref, err := reference.Parse("app:1.0")
+	require.NoError(t, err)
+
+	_, err = service.uncompressedLayerSize(context.Background(), ref, models.LayerMetadata{
+		Digest:    sha256Digest([]byte("other")),
+		MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+	})
+	require.ErrorContains(t, err, "digest mismatch")
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+
+	"gopkg.in/yaml.v3"
+)
+
+// imageMapKey is the conventional key of image maps and image strings
+const imageMapKey = "image"
+
+// imageMapFields are the keys of an image map, in the order they are listed
+// in --set expressions
+var imageMapFields = []string{"registry", "repository", "tag", "digest"}
+
+// discoveryContext carries the chart-wide settings that affect image names
+type discoveryContext struct {
+	globalRegistry string // global.imageRegistry
+}
+
+// setField is a value that makes up an image; key is relative to the image
+// path, empty for image strings
+type setField struct {
+	key   string
+	value string
+}
+
+// discoveredImage is an image found in a document, before its path is made
+// relative to the top-level chart values
+type discoveredImage struct {
+	image  models.ContainerImage
+	path   []string // keys and list selectors such as "[0]"
+	line   int
+	column int
+	fields []setField
+}
+
+// FindContainerImages searches for container images in YAML structure, given
+// as a *yaml.Node or as decoded values. Image strings (`image: nginx:1.25`)
+// and image maps are recognized; image maps follow the common chart
+// conventions: `registry`, `repository`, `tag` and `digest` keys, the digest
+// winning over the tag, `global.imageRegistry` overriding the registry, and
+// maps keyed under names other than `image` (e.g. `metrics.exporterImage`) as
+// long as they have a repository and a tag or digest. Each image carries its
+// values path, position and a --set expression overriding it.
+func (s *HELMService) FindContainerImages(content any) []models.ContainerImage {
+	return finalizeImages(discoverImages(content), models.YAMLDocument{Values: true})
+}
+
+// discoverImages runs the built-in discovery on the YAML node tree of content
+func discoverImages(content any) []discoveredImage {
+	root := contentNode(content)
+	if root == nil {
+		return nil
+	}
+
+	var ctx discoveryContext
+	if global := mappingValue(root, "global"); global != nil {
+		ctx.globalRegistry = scalarValue(mappingValue(global, "imageRegistry"))
+	}
+	return findImages(root, nil, ctx)
+}
+
+// findImages walks a YAML node tree in document order
+func findImages(node *yaml.Node, path []string, ctx discoveryContext) []discoveredImage {
+	var images []discoveredImage
+
+	node = resolveNode(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Check for direct image string format
+		if key, value := mappingEntry(node, imageMapKey); value != nil && value.Kind == yaml.ScalarNode {
+			if image := scalarValue(value); image != "" {
+				images = append(images, discoveredImage{
+					image:  newContainerImage(image, scalarValue(mappingValue(node, "name"))),
+					path:   appendPath(path, imageMapKey),
+					line:   key.Line,
+					column: key.Column,
+					fields: []setField{{value: image}},
+				})
+			}
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], resolveNode(node.Content[i+1])
+			childPath := appendPath(path, key.Value)
+
+			if value.Kind == yaml.MappingNode {
+				if name, fields, ok := imageMapName(key.Value, value, ctx); ok {
+					images = append(images, discoveredImage{
+						image:  newContainerImage(name, ""),
+						path:   childPath,
+						line:   key.Line,
+						column: key.Column,
+						fields: fields,
+					})
+					continue
+				}
+			}
+			images = append(images, findImages(value, childPath, ctx)...)
+		}
+
+	case yaml.SequenceNode:
+		// Recursively check all elements in sequence
+		for i, item := range node.Content {
+			images = append(images, findImages(item, appendPath(path, fmt.Sprintf("[%d]", i)), ctx)...)
+		}
+	}
+
+	return images
+}
+
+// imageMapName builds the image name of an image map such as
+// {registry: docker.io, repository: bitnami/nginx, tag: 1.25.3} and returns
+// the fields it was built from. Maps under keys other than `image` need a tag
+// or digest besides the repository.
+func imageMapName(key string, imageMap *yaml.Node, ctx discoveryContext) (string, []setField, bool) {
+	values := map[string]string{}
+	var fields []setField
+	for _, field := range imageMapFields {
+		if value := scalarValue(mappingValue(imageMap, field)); value != "" {
+			values[field] = value
+			fields = append(fields, setField{key: field, value: value})
+		}
+	}
+
+	repository := values["repository"]
+	if repository == "" || strings.Contains(repository, "://") {
+		return "", nil, false
+	}
+	if key != imageMapKey && values["tag"] == "" && values["digest"] == "" {
+		return "", nil, false
+	}
+
+	registry := values["registry"]
+	if ctx.globalRegistry != "" {
+		registry = ctx.globalRegistry
+	}
+	return joinImageName(registry, repository, values["tag"], values["digest"]), fields, true
+}
+
+// joinImageName builds an image name from its parts; the digest wins over
+// the tag, which defaults to "latest"
+func joinImageName(registry, repository, tag, digest string) string {
+	if registry != "" {
+		repository = strings.TrimSuffix(registry, "/") + "/" + repository
+	}
+
+	switch {
+	case digest != "":
+		if !strings.Contains(digest, ":") {
+			digest = "sha256:" + digest
+		}
+		return repository + "@" + digest
+	case tag == "":
+		tag = reference.DefaultTag
+	}
+	return reference.Join(repository, tag)
+}
+
+// finalizeImages turns discovered images into the images of a document:
+// paths are prefixed with the position of the document's values in the
+// top-level chart, positions missing from content are looked up in the
+// source file, and values documents get --set expressions
+func finalizeImages(discovered []discoveredImage, doc models.YAMLDocument) []models.ContainerImage {
+	var prefix []string
+	if doc.ValuesPrefix != "" {
+		prefix = strings.Split(doc.ValuesPrefix, ".")
+	}
+
+	images := make([]models.ContainerImage, 0, len(discovered))
+	for _, d := range discovered {
+		image := d.image
+		image.Line, image.Column = d.line, d.column
+		if image.Line == 0 && doc.Node != nil {
+			if node := nodeAtPath(doc.Node, d.path); node != nil {
+				image.Line, image.Column = node.Line, node.Column
+			}
+		}
+
+		path := append(append([]string{}, prefix...), d.path...)
+		image.Path = formatPath(path)
+
+		if doc.Values && len(d.fields) > 0 {
+			assignments := make([]string, 0, len(d.fields))
+			for _, field := range d.fields {
+				fieldPath := path
+				if field.key != "" {
+					fieldPath = appendPath(path, field.key)
+				}
+				assignments = append(assignments, formatPath(fieldPath)+"="+escapeSetValue(field.value))
+			}
+			image.Set = strings.Join(assignments, ",")
+		}
+
+		images = append(images, image)
+	}
+	return images
+}
+
+// manifestWorkload returns the "Kind/name" of a workload manifest, one of
+// the kinds with a pod spec, or an empty string for other content
+func manifestWorkload(root *yaml.Node) string {
+	kind := scalarValue(mappingValue(root, "kind"))
+	name := scalarValue(mappingValue(mappingValue(root, "metadata"), "name"))
+	if _, ok := podSpecPaths[kind]; !ok || name == "" {
+		return ""
+	}
+	return kind + "/" + name
+}
+
+// contentNode returns the YAML node tree of content, encoding decoded values
+func contentNode(content any) *yaml.Node {
+	if node, ok := content.(*yaml.Node); ok {
+		return resolveNode(node)
+	}
+	if content == nil {
+		return nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(content); err != nil {
+		return nil
+	}
+	return &node
+}
+
+// resolveNode unwraps document nodes and follows aliases
+func resolveNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch {
+		case node.Kind == yaml.DocumentNode && len(node.Content) > 0:
+			node = node.Content[0]
+		case node.Kind == yaml.AliasNode && node.Alias != nil:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// mappingEntry returns the key and value nodes of a mapping entry
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	node = resolveNode(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], resolveNode(node.Content[i+1])
+		}
+	}
+	return nil, nil
+}
+
+// mappingValue returns the value node of a mapping entry
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(node, key)
+	return value
+}
+
+// scalarValue returns the value of a scalar node; numeric tags such as 15
+// keep their original form, and nulls are empty
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// nodeAtPath returns the node at a path: the key node of mapping entries,
+// which marks the line the value is defined on, or the item of a sequence
+func nodeAtPath(root *yaml.Node, path []string) *yaml.Node {
+	current, located := resolveNode(root), resolveNode(root)
+	for _, segment := range path {
+		if current == nil {
+			return nil
+		}
+		if strings.HasPrefix(segment, "[") {
+			var index int
+			if _, err := fmt.Sscanf(segment, "[%d]", &index); err != nil || current.Kind != yaml.SequenceNode || index >= len(current.Content) {
+				return nil
+			}
+			current = resolveNode(current.Content[index])
+			located = current
+			continue
+		}
+
+		key, value := mappingEntry(current, segment)
+		if key == nil {
+			return nil
+		}
+		current, located = value, key
+	}
+	return located
+}
+
+// appendPath returns a copy of path with segment appended
+func appendPath(path []string, segment string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), segment)
+}
+
+// formatPath formats path segments as a dotted values path such as
+// "controller.image" or "spec.containers[0].image"; dots in keys are escaped
+// as in --set expressions
+func formatPath(path []string) string {
+	var b strings.Builder
+	for i, segment := range path {
+		if strings.HasPrefix(segment, "[") {
+			b.WriteString(segment)
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(escapeSetKey(segment))
+	}
+	return b.String()
+}
+
+// escapeSetKey escapes the characters with a meaning in --set keys
+func escapeSetKey(key string) string {
+	return strings.NewReplacer(`\`, `\\`, ".", `\.`, ",", `\,`, "=", `\=`, "[", `\[`, "]", `\]`).Replace(key)
+}
+
+// escapeSetValue escapes the characters with a meaning in --set values
+func escapeSetValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(value)
+}
+
+// scalarString returns a decoded YAML scalar as a string; numeric tags such
+// as 15 are parsed as numbers and converted back
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int, int64, uint64, float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// newContainerImage creates a ContainerImage with the parsed parts of its
+// reference; names that fail to parse are kept without them
+func newContainerImage(name, container string) models.ContainerImage {
+	image := models.ContainerImage{
+		Name:      name,
+		Container: container,
+	}
+
+	if ref, err := reference.Parse(name); err == nil {
+		image.Registry = ref.Registry
+		image.Namespace = ref.Namespace
+		image.Repository = ref.Repository
+		image.Tag = ref.Tag
+		image.Digest = ref.Digest
+	}
+
+	return image
+}
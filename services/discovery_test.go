@@ -0,0 +1,218 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFindContainerImages(t *testing.T) {
+	svc := &HELMService{}
+
+	t.Run("Helm style image map", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "nginx",
+				"tag":        "1.21",
+			},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "nginx:1.21", imgs[0].Name)
+	})
+
+	t.Run("Helm style image map with no tag", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "nginx",
+			},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "nginx:latest", imgs[0].Name)
+	})
+
+	t.Run("Direct image string", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": "alpine:3.18",
+			"name":  "test-container",
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "alpine:3.18", imgs[0].Name)
+		require.Equal(t, "test-container", imgs[0].Container)
+	})
+
+	t.Run("Parsed reference parts", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": "localhost:5000/team/app:1.2",
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "localhost:5000/team/app:1.2", imgs[0].Name)
+		require.Equal(t, "localhost:5000", imgs[0].Registry)
+		require.Equal(t, "team", imgs[0].Namespace)
+		require.Equal(t, "app", imgs[0].Repository)
+		require.Equal(t, "1.2", imgs[0].Tag)
+	})
+
+	t.Run("Helm style image map with digest tag", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "nginx",
+				"tag":        digestFor("a"),
+			},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "nginx@"+digestFor("a"), imgs[0].Name)
+		require.Equal(t, "library", imgs[0].Namespace)
+		require.Equal(t, digestFor("a"), imgs[0].Digest)
+		require.Empty(t, imgs[0].Tag)
+	})
+
+	t.Run("Nested images", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{
+						"image": "busybox:1.36",
+					},
+				},
+			},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "busybox:1.36", imgs[0].Name)
+	})
+
+	t.Run("Registry and digest", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"image": map[string]interface{}{
+				"registry":   "docker.io",
+				"repository": "bitnami/nginx",
+				"tag":        "1.25.3",
+				"digest":     digestFor("b"),
+			},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 1)
+		require.Equal(t, "docker.io/bitnami/nginx@"+digestFor("b"), imgs[0].Name)
+		require.Equal(t, "bitnami", imgs[0].Namespace)
+		require.Empty(t, imgs[0].Tag)
+	})
+
+	t.Run("Global image registry", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"global": map[string]interface{}{"imageRegistry": "mirror.example.com"},
+			"image": map[string]interface{}{
+				"registry":   "docker.io",
+				"repository": "bitnami/nginx",
+				"tag":        "1.25.3",
+			},
+			"metrics": map[string]interface{}{
+				"image": map[string]interface{}{"repository": "bitnami/nginx-exporter", "tag": "1.1.0"},
+			},
+			"sidecar": map[string]interface{}{"image": "busybox:1.36"},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		names := make([]string, 0, len(imgs))
+		for _, img := range imgs {
+			names = append(names, img.Name)
+		}
+		require.Equal(t, []string{
+			"mirror.example.com/bitnami/nginx:1.25.3",
+			"mirror.example.com/bitnami/nginx-exporter:1.1.0",
+			"busybox:1.36",
+		}, names)
+	})
+
+	t.Run("Image maps under other keys", func(t *testing.T) {
+		yaml := map[string]interface{}{
+			"metrics": map[string]interface{}{
+				"exporterImage": map[string]interface{}{"repository": "prom/exporter", "tag": 15},
+			},
+			"volumePermissions": map[string]interface{}{
+				"busybox": map[string]interface{}{"repository": "busybox", "digest": strings.Repeat("c", 64)},
+			},
+			"chart": map[string]interface{}{"repository": "https://charts.example.com", "tag": "v1"},
+			"git":   map[string]interface{}{"repository": "org/app"},
+		}
+		imgs := svc.FindContainerImages(yaml)
+		require.Len(t, imgs, 2)
+		require.Equal(t, "prom/exporter:15", imgs[0].Name)
+		require.Equal(t, "busybox@sha256:"+strings.Repeat("c", 64), imgs[1].Name)
+	})
+}
+
+func TestFindDocumentImages_Locations(t *testing.T) {
+	source := `controller:
+  admissionWebhooks:
+    patch:
+      image:
+        registry: registry.k8s.io
+        repository: ingress-nginx/kube-webhook-certgen
+        tag: v1.4.0
+  containers:
+    - name: app
+      image: nginx:1.25
+annotations:
+  example.com/image:
+    repository: org/app
+    tag: "1.0"
+`
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(source), &node))
+
+	service := NewHELMService()
+	images := service.FindDocumentImages(models.YAMLDocument{Source: "values.yaml", Values: true, Content: &node})
+	require.Len(t, images, 3)
+
+	require.Equal(t, "registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.4.0", images[0].Name)
+	require.Equal(t, "controller.admissionWebhooks.patch.image", images[0].Path)
+	require.Equal(t, 4, images[0].Line)
+	require.Equal(t, 7, images[0].Column)
+	require.Equal(t, "controller.admissionWebhooks.patch.image.registry=registry.k8s.io,"+
+		"controller.admissionWebhooks.patch.image.repository=ingress-nginx/kube-webhook-certgen,"+
+		"controller.admissionWebhooks.patch.image.tag=v1.4.0", images[0].Set)
+
+	require.Equal(t, "controller.containers[0].image", images[1].Path)
+	require.Equal(t, 10, images[1].Line)
+	require.Equal(t, "controller.containers[0].image=nginx:1.25", images[1].Set)
+	require.Equal(t, "app", images[1].Container)
+
+	require.Equal(t, `annotations.example\.com/image`, images[2].Path)
+	require.Equal(t, `annotations.example\.com/image.repository=org/app,annotations.example\.com/image.tag=1.0`, images[2].Set)
+
+	// The --set expressions round-trip through the --set parser
+	values := map[string]any{}
+	require.NoError(t, parseSetValues(images[2].Set, values))
+	require.Equal(t, map[string]any{"annotations": map[string]any{"example.com/image": map[string]any{"repository": "org/app", "tag": "1.0"}}}, values)
+}
+
+func TestFindDocumentImages_SubchartValues(t *testing.T) {
+	source := "image:\n  repository: redis\n  tag: \"7.2\"\n"
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(source), &node))
+
+	// Coalesced values carry no positions; they are looked up in the source file
+	content := map[string]any{"image": map[string]any{"repository": "redis", "tag": "7.4"}}
+
+	service := NewHELMService()
+	images := service.FindDocumentImages(models.YAMLDocument{Values: true, ValuesPrefix: "cache", Content: content, Node: &node})
+	require.Len(t, images, 1)
+	require.Equal(t, "redis:7.4", images[0].Name)
+	require.Equal(t, "cache.image", images[0].Path)
+	require.Equal(t, 1, images[0].Line)
+	require.Equal(t, "cache.image.repository=redis,cache.image.tag=7.4", images[0].Set)
+
+	// Manifests have paths and positions but no --set expressions
+	images = service.FindDocumentImages(models.YAMLDocument{Content: &node})
+	require.Len(t, images, 1)
+	require.Equal(t, "image", images[0].Path)
+	require.Empty(t, images[0].Set)
+}
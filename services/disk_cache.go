@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// diskCacheBucket is the bucket holding the cache entries
+var diskCacheBucket = []byte("images")
+
+// DiskCache is a CacheBackend stored in a bbolt database file, so that
+// cached image metadata survives restarts
+type DiskCache struct {
+	db *bolt.DB
+}
+
+// NewDiskCache opens or creates the cache database at path
+func NewDiskCache(path string) (*DiskCache, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache file: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache file: %w", err)
+	}
+
+	return &DiskCache{db: db}, nil
+}
+
+// Get returns the value of a key
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	var value []byte
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(diskCacheBucket).Get([]byte(key)); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return value, value != nil
+}
+
+// Set stores the value of a key
+func (c *DiskCache) Set(key string, value []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskCacheBucket).Put([]byte(key), value)
+	})
+}
+
+// Close closes the cache database
+func (c *DiskCache) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"helm-viewer/models"
+)
+
+// statusError is an unexpected HTTP status returned by a registry or the
+// Docker Hub API
+type statusError struct {
+	message    string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// lookupError classifies an image lookup error by its cause
+func lookupError(err error) *models.ImageError {
+	imageErr := &models.ImageError{Code: models.ImageErrorUnknown, Message: err.Error()}
+
+	var status *statusError
+	var open *circuitOpenError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &open):
+		imageErr.Code = models.ImageErrorCircuitOpen
+	case errors.As(err, &status):
+		switch status.statusCode {
+		case http.StatusNotFound:
+			imageErr.Code = models.ImageErrorNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			imageErr.Code = models.ImageErrorUnauthorized
+		case http.StatusTooManyRequests:
+			imageErr.Code = models.ImageErrorRateLimited
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			imageErr.Code = models.ImageErrorTimeout
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		imageErr.Code = models.ImageErrorTimeout
+	}
+	return imageErr
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"not found", &statusError{"error getting manifest 1.0: 404 Not Found", http.StatusNotFound}, models.ImageErrorNotFound},
+		{"unauthorized", &statusError{"registry ghcr.io requires credentials", http.StatusUnauthorized}, models.ImageErrorUnauthorized},
+		{"forbidden", &statusError{"error getting token: 403 Forbidden", http.StatusForbidden}, models.ImageErrorUnauthorized},
+		{"rate limited", &statusError{"error getting manifest 1.0: 429 Too Many Requests", http.StatusTooManyRequests}, models.ImageErrorRateLimited},
+		{"gateway timeout", &statusError{"error getting manifest 1.0: 504 Gateway Timeout", http.StatusGatewayTimeout}, models.ImageErrorTimeout},
+		{"deadline", fmt.Errorf("error requesting registry docker.io: %w", context.DeadlineExceeded), models.ImageErrorTimeout},
+		{"server error", &statusError{"error getting manifest 1.0: 500 Internal Server Error", http.StatusInternalServerError}, models.ImageErrorUnknown},
+		{"other", errors.New("unsupported manifest media type"), models.ImageErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("failed to get image manifest: %w", tt.err)
+			require.Equal(t, &models.ImageError{Code: tt.code, Message: wrapped.Error()}, lookupError(wrapped))
+		})
+	}
+}
+
+func TestGetImageInfo_Errors(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]string{})
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	var imageErr *models.ImageError
+
+	_, _, err := service.GetImageInfo(context.Background(), "nginx:0.0")
+	require.ErrorAs(t, err, &imageErr)
+	require.Equal(t, models.ImageErrorNotFound, imageErr.Code)
+
+	_, _, err = service.GetImageInfo(context.Background(), "Nginx:latest")
+	require.ErrorAs(t, err, &imageErr)
+	require.Equal(t, models.ImageErrorInvalidReference, imageErr.Code)
+}
@@ -1,107 +1,181 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
+	"helm-viewer/config"
 	"helm-viewer/models"
+	"helm-viewer/reference"
 
-	"gopkg.in/yaml.v3"
+	"golang.org/x/sync/singleflight"
 )
 
 // HELMService provides methods for working with YAML documents
 type HELMService struct {
-	dockerHubBaseURL string
+	dockerHubBaseURL   string
+	dockerHubMetadata  bool
+	registryBaseURL    string
+	insecureRegistries map[string]bool
+	platform           platform
+	extractionRules    []config.ExtractionRule
+
+	httpClient  *http.Client
+	retry       retryPolicy
+	breakers    *circuitBreakers
+	rateLimits  *rateLimiters
+	cache       *imageCache
+	lookups     singleflight.Group
+	lookupSlots chan struct{}
+	lookupsMu   sync.Mutex
+	lookupCalls map[string]*lookupCall
+
+	credentialsMu       sync.RWMutex
+	credentials         map[string]config.Credentials
+	credentialsProvider CredentialsProvider
+	tokens              tokenCache
+	now                 func() time.Time
 }
 
 // NewHELMService creates a new instance of HELMService
 func NewHELMService() *HELMService {
 	return &HELMService{
-		dockerHubBaseURL: "https://hub.docker.com",
+		dockerHubBaseURL:   "https://hub.docker.com",
+		dockerHubMetadata:  true,
+		registryBaseURL:    "https://registry-1.docker.io",
+		insecureRegistries: map[string]bool{},
+		platform:           platform{OS: "linux", Architecture: "amd64"},
+		credentials:        map[string]config.Credentials{},
+		now:                time.Now,
+		httpClient:         newHTTPClient(config.DefaultConnectTimeout, config.DefaultReadTimeout),
+		retry:              retryPolicy{attempts: config.DefaultRetryAttempts, baseDelay: config.DefaultRetryBaseDelay, maxDelay: config.DefaultRetryMaxDelay},
+		breakers:           newCircuitBreakers(config.DefaultBreakerThreshold, config.DefaultBreakerCooldown),
+		rateLimits:         newRateLimiters(nil, config.DefaultLowQuota),
+		lookupSlots:        make(chan struct{}, config.DefaultMaxConcurrentLookups),
+		lookupCalls:        map[string]*lookupCall{},
+		cache:              &imageCache{backend: NewMemoryCache(config.DefaultCacheSize), tagTTL: config.DefaultCacheTagTTL},
 	}
 }
 
+// SetMaxConcurrentLookups sets the limit of image lookups running at a time
+// across all requests; it must be called before the service is used
+func (s *HELMService) SetMaxConcurrentLookups(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.lookupSlots = make(chan struct{}, n)
+}
+
 // SetDockerHubBaseURL sets the base URL for Docker Hub API calls (used in testing)
 func (s *HELMService) SetDockerHubBaseURL(url string) {
 	s.dockerHubBaseURL = url
 }
 
-// LoadAndParseYAML loads and parses a YAML document from URL
-func (s *HELMService) LoadAndParseYAML(url string) (any, error) {
+// SetDockerHubMetadata enables or disables the Docker Hub tags API as a
+// fallback source of image size for Docker Hub images
+func (s *HELMService) SetDockerHubMetadata(enabled bool) {
+	s.dockerHubMetadata = enabled
+}
+
+// SetRegistryBaseURL sets the base URL for Docker Hub registry API calls (used in testing)
+func (s *HELMService) SetRegistryBaseURL(url string) {
+	s.registryBaseURL = url
+}
+
+// SetInsecureRegistries sets the registry hosts that are accessed over plain HTTP
+func (s *HELMService) SetInsecureRegistries(hosts ...string) {
+	s.insecureRegistries = map[string]bool{}
+	for _, host := range hosts {
+		s.insecureRegistries[host] = true
+	}
+}
+
+// SetPlatform sets the platform ("os/arch[/variant]") used to pick a manifest from an image index
+func (s *HELMService) SetPlatform(p string) error {
+	parsed, err := parsePlatform(p)
+	if err != nil {
+		return err
+	}
+	s.platform = parsed
+	return nil
+}
+
+// LoadAndParseYAML loads a YAML document or a packaged chart (.tgz) from URL,
+// or pulls a chart from an OCI registry for oci:// URLs, and parses it into
+// documents tagged with their source file. The values overrides of opts are
+// merged over the chart defaults, and charts are rendered first when
+// opts.Render is set.
+func (s *HELMService) LoadAndParseYAML(ctx context.Context, url string, opts models.LoadOptions) ([]models.YAMLDocument, error) {
+	values, err := s.userValues(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if isOCIChartURL(url) {
+		archive, err := s.pullOCIChart(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return loadChartArchive(ctx, archive, values, opts)
+	}
+
 	// Load YAML document from URL
-	resp, err := http.Get(url)
+	resp, err := s.httpGet(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch YAML document: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch YAML document: %s", resp.Status)
+	}
+
 	// Read content
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read YAML content: %w", err)
 	}
-
-	// Parse YAML
-	var yamlContent any
-	if err := yaml.Unmarshal(body, &yamlContent); err != nil {
-		return nil, fmt.Errorf("invalid YAML format: %w", err)
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("document exceeds %d bytes", maxDownloadSize)
 	}
 
-	return yamlContent, nil
-}
-
-// FindContainerImages searches for container images in YAML structure
-func (s *HELMService) FindContainerImages(content any) []models.ContainerImage {
-	var images []models.ContainerImage
-
-	switch v := content.(type) {
-	case map[string]any:
-		// Check for Helm chart image format
-		if imageMap, ok := v["image"].(map[string]any); ok {
-			repository, _ := imageMap["repository"].(string)
-			tag, _ := imageMap["tag"].(string)
-
-			if repository != "" {
-				if tag == "" {
-					tag = "latest"
-				}
+	// Packaged charts are gzip tar archives
+	if isGzip(body) {
+		return loadChartArchive(ctx, body, values, opts)
+	}
+	if opts.Render {
+		return nil, fmt.Errorf("only charts can be rendered, %s is a YAML document", url)
+	}
 
-				images = append(images, models.ContainerImage{
-					Name:      fmt.Sprintf("%s:%s", repository, tag),
-					Container: "",
-				})
-			}
-		}
+	// Parse every document of the stream; Kubernetes resources are scanned
+	// as manifests, other documents as chart values
+	docs, err := parseYAMLDocuments(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YAML format: %w", err)
+	}
 
-		// Check for direct image string format
-		if image, ok := v["image"].(string); ok {
-			containerName := ""
-			if name, ok := v["name"].(string); ok {
-				containerName = name
-			}
-
-			images = append(images, models.ContainerImage{
-				Name:      image,
-				Container: containerName,
-			})
+	coalesced := false
+	for i := range docs {
+		docs[i].Source = path.Base(resp.Request.URL.Path)
+		if isManifest(docs[i].Node) {
+			continue
 		}
-
-		// Recursively check all values in map
-		for _, value := range v {
-			images = append(images, s.FindContainerImages(value)...)
-		}
-
-	case []interface{}:
-		// Recursively check all elements in slice
-		for _, item := range v {
-			images = append(images, s.FindContainerImages(item)...)
+		docs[i].Values = true
+		// User values only override the first values document
+		if defaults, ok := docs[i].Content.(map[string]any); ok && !coalesced {
+			docs[i].Content = coalesceValues(values, defaults)
+			coalesced = true
 		}
 	}
-
-	return images
+	return docs, nil
 }
 
 // formatSize converts bytes to human-readable format
@@ -117,27 +191,26 @@ func formatSize(size int64) string {
 }
 
 // GetDockerHubResponse makes a request to Docker Hub API and returns the response body
-func (s *HELMService) GetDockerHubResponse(imageName string) ([]byte, error) {
-	// Split image name into repository and tag
-	parts := strings.Split(imageName, ":")
-	repository := parts[0]
-	tag := "latest"
-	if len(parts) > 1 {
-		tag = parts[1]
+func (s *HELMService) GetDockerHubResponse(ctx context.Context, imageName string) ([]byte, error) {
+	ref, err := reference.Parse(imageName)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check if it's an official image
-	var url string
-	if !strings.Contains(repository, "/") {
-		// Official image
-		url = fmt.Sprintf("%s/v2/repositories/library/%s/tags/%s", s.dockerHubBaseURL, repository, tag)
-	} else {
-		// Custom image
-		url = fmt.Sprintf("%s/v2/repositories/%s/tags/%s", s.dockerHubBaseURL, repository, tag)
+	if ref.Registry != reference.DockerHubRegistry {
+		return nil, fmt.Errorf("image %s is not hosted on Docker Hub", imageName)
+	}
+	if ref.Tag == "" {
+		return nil, fmt.Errorf("Docker Hub tags API requires a tag for image %s", imageName)
 	}
 
+	url := fmt.Sprintf("%s/v2/repositories/%s/tags/%s", s.dockerHubBaseURL, ref.Path(), ref.Tag)
+
 	// Make GET request
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Docker Hub request: %w", err)
+	}
+	resp, err := s.sendRegistryRequest(req, quotaKey{registry: reference.DockerHubRegistry, credential: anonymousCredential})
 	if err != nil {
 		return nil, fmt.Errorf("error requesting Docker Hub: %w", err)
 	}
@@ -145,7 +218,7 @@ func (s *HELMService) GetDockerHubResponse(imageName string) ([]byte, error) {
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error getting image information: %s", resp.Status)
+		return nil, &statusError{fmt.Sprintf("error getting image information: %s", resp.Status), resp.StatusCode}
 	}
 
 	// Read response body
@@ -175,34 +248,207 @@ func (s *HELMService) GetImageSize(body []byte) (int64, error) {
 	return result.FullSize, nil
 }
 
-// GetImageLayers gets the number of layers for an image
-// TODO: Implement layer counting by:
-// 1. Parse the Docker Hub API response to get the digest
-// 2. Use the digest to fetch the manifest from Docker Registry API
-// 3. Parse the manifest to count the number of layers
-// 4. Handle different manifest formats (v2 schema 1, v2 schema 2, OCI)
-// 5. Consider caching the results to avoid repeated API calls
-func (s *HELMService) GetImageLayers(body []byte) (int, error) {
-	return 0, nil
+// GetImageLayers gets the number of layers for an image from its registry manifest
+func (s *HELMService) GetImageLayers(ctx context.Context, imageName string) (int, error) {
+	ref, err := reference.Parse(imageName)
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := s.resolveManifest(ctx, ref, nil, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.layerCount()
+}
+
+// GetImageInfo gets the human-readable size and the layer count of an image,
+// as looked up by GetImageMetadata
+func (s *HELMService) GetImageInfo(ctx context.Context, imageName string) (string, int, error) {
+	metadata, err := s.GetImageMetadata(ctx, imageName, models.LookupOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	return metadata.Size, metadata.Layers, nil
 }
 
-// GetImageInfo gets image size from Docker Hub
-func (s *HELMService) GetImageInfo(imageName string) (string, int, error) {
-	body, err := s.GetDockerHubResponse(imageName)
+// GetImageMetadata gets image size and layer count from the image's registry.
+// The size is the sum of the manifest layer sizes; for Docker Hub images whose
+// manifest carries no sizes the Docker Hub tags API is used when enabled.
+// Concurrent lookups of the same image share one upstream call, and at most
+// the configured number of lookups run at a time across all requests.
+// Errors are *models.ImageError values classifying the failure.
+func (s *HELMService) GetImageMetadata(ctx context.Context, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	ref, err := reference.Parse(imageName)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to get DockerHub response: %w", err)
+		return models.ImageMetadata{}, &models.ImageError{Code: models.ImageErrorInvalidReference, Message: err.Error()}
+	}
+	// Uncompressed sizes are measured layer by layer, and platforms are
+	// found from the digests the reference resolved to
+	if opts.Uncompressed || len(opts.Platforms) > 0 {
+		opts.Details = true
+	}
+
+	for {
+		info, err := s.sharedLookup(ctx, ref, imageName, opts)
+		// A shared lookup is canceled when all the callers that joined it
+		// before this one went away; start over unless this caller did too
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return models.ImageMetadata{}, lookupError(err)
+		}
+		return info, nil
+	}
+}
+
+// lookupCall is the context of a shared image lookup, canceled once no
+// caller waits for it anymore
+type lookupCall struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// sharedLookup looks up an image once for all concurrent callers. The lookup
+// runs under its own context so that one caller going away does not fail the
+// others; it is canceled when every caller is gone.
+func (s *HELMService) sharedLookup(ctx context.Context, ref reference.Reference, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	key := fmt.Sprintf("%s %t %t %s", ref.String(), opts.Details, opts.Uncompressed, strings.Join(opts.Platforms, ","))
+
+	s.lookupsMu.Lock()
+	call, ok := s.lookupCalls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.Background())
+		call = &lookupCall{ctx: callCtx, cancel: cancel}
+		s.lookupCalls[key] = call
+	}
+	call.waiters++
+	s.lookupsMu.Unlock()
+
+	defer func() {
+		s.lookupsMu.Lock()
+		defer s.lookupsMu.Unlock()
+		if call.waiters--; call.waiters == 0 {
+			call.cancel()
+			delete(s.lookupCalls, key)
+		}
+	}()
+
+	results := s.lookups.DoChan(key, func() (any, error) {
+		select {
+		case s.lookupSlots <- struct{}{}:
+		case <-call.ctx.Done():
+			return models.ImageMetadata{}, call.ctx.Err()
+		}
+		defer func() { <-s.lookupSlots }()
+
+		return s.lookupImageMetadata(call.ctx, ref, imageName, opts)
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return models.ImageMetadata{}, result.Err
+		}
+		return result.Val.(models.ImageMetadata), nil
+	case <-ctx.Done():
+		return models.ImageMetadata{}, ctx.Err()
+	}
+}
+
+// lookupImageMetadata gets image metadata from the metadata cache or the
+// registry; cached entries without details are fetched again for detailed
+// lookups
+func (s *HELMService) lookupImageMetadata(ctx context.Context, ref reference.Reference, imageName string, opts models.LookupOptions) (models.ImageMetadata, error) {
+	image, ok := s.cache.get(ref, s.platform, s.now())
+	if !ok || (opts.Details && image.Details == nil) {
+		var err error
+		if image, err = s.fetchImageMetadata(ctx, ref, imageName, opts); err != nil {
+			return models.ImageMetadata{}, err
+		}
+	}
+
+	metadata := newImageMetadata(image)
+	if opts.Uncompressed {
+		s.measureUncompressed(ctx, ref, &metadata)
 	}
+	if len(opts.Platforms) > 0 {
+		if err := s.inspectPlatforms(ctx, ref, &metadata, opts.Platforms); err != nil {
+			return models.ImageMetadata{}, err
+		}
+	}
+	return metadata, nil
+}
 
-	size, err := s.GetImageSize(body)
+// fetchImageMetadata gets image size and layer count, and with details the
+// manifest and configuration details, from the registry and caches them.
+// Images of indexes lacking the configured platform are taken from the
+// first wanted platform the index has, and not cached as the configured one.
+func (s *HELMService) fetchImageMetadata(ctx context.Context, ref reference.Reference, imageName string, opts models.LookupOptions) (cachedImage, error) {
+	wanted, all, err := parseWantedPlatforms(opts.Platforms)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to get image size: %w", err)
+		return cachedImage{}, err
+	}
+	m, err := s.resolveManifest(ctx, ref, wanted, all)
+	if err != nil {
+		return cachedImage{}, fmt.Errorf("failed to get image manifest: %w", err)
 	}
 
 	// Get number of layers
-	layers, err := s.GetImageLayers(body)
+	layers, err := m.layerCount()
+	if err != nil {
+		return cachedImage{}, fmt.Errorf("failed to get image layers: %w", err)
+	}
+
+	size, err := m.totalSize()
+	if err != nil && s.dockerHubMetadata && ref.Registry == reference.DockerHubRegistry {
+		size, err = s.getDockerHubSize(ctx, imageName)
+	}
+	if err != nil {
+		return cachedImage{}, fmt.Errorf("failed to get image size: %w", err)
+	}
+
+	image := cachedImage{Size: size, Layers: layers, Fetched: s.now()}
+	if opts.Details {
+		if image.Details, err = s.imageDetails(ctx, ref, m); err != nil {
+			return cachedImage{}, err
+		}
+	}
+	if m.platform != nil && !m.platform.matches(s.platform) {
+		return image, nil
+	}
+	s.cache.set(ref, m.imageDigest(), s.platform, image, image.Fetched)
+	return image, nil
+}
+
+// newImageMetadata creates the metadata of a cached image
+func newImageMetadata(image cachedImage) models.ImageMetadata {
+	metadata := models.ImageMetadata{
+		Size:    formatSize(image.Size),
+		Bytes:   image.Size,
+		Layers:  image.Layers,
+		Fetched: image.Fetched,
+	}
+	if details := image.Details; details != nil {
+		metadata.Digest = details.Digest
+		metadata.ManifestDigest = details.ManifestDigest
+		metadata.MediaType = details.MediaType
+		metadata.Platform = details.Platform
+		metadata.Created = details.Created
+		metadata.LayerDetails = append([]models.LayerMetadata{}, details.Layers...)
+	}
+	return metadata
+}
+
+// getDockerHubSize gets image size from the Docker Hub tags API
+func (s *HELMService) getDockerHubSize(ctx context.Context, imageName string) (int64, error) {
+	body, err := s.GetDockerHubResponse(ctx, imageName)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to get image layers: %w", err)
+		return 0, fmt.Errorf("failed to get DockerHub response: %w", err)
 	}
 
-	return formatSize(size), layers, nil
+	return s.GetImageSize(body)
 }
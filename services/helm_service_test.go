@@ -1,11 +1,17 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"helm-viewer/models"
 
 	"github.com/stretchr/testify/require"
 )
@@ -30,13 +36,14 @@ containers:
 	defer server.Close()
 
 	service := NewHELMService()
-	content, err := service.LoadAndParseYAML(server.URL)
+	docs, err := service.LoadAndParseYAML(context.Background(), server.URL+"/charts/values.yaml", models.LoadOptions{})
 
 	require.NoError(t, err)
-	require.NotNil(t, content)
+	require.Len(t, docs, 1)
+	require.Equal(t, "values.yaml", docs[0].Source)
 
 	// Verify the content structure
-	contentMap, ok := content.(map[string]interface{})
+	contentMap, ok := docs[0].Content.(map[string]interface{})
 	require.True(t, ok)
 
 	// Check image section
@@ -46,59 +53,6 @@ containers:
 	require.Equal(t, "latest", imageMap["tag"])
 }
 
-func TestFindContainerImages(t *testing.T) {
-	svc := &HELMService{}
-
-	t.Run("Helm style image map", func(t *testing.T) {
-		yaml := map[string]interface{}{
-			"image": map[string]interface{}{
-				"repository": "nginx",
-				"tag":        "1.21",
-			},
-		}
-		imgs := svc.FindContainerImages(yaml)
-		require.Len(t, imgs, 1)
-		require.Equal(t, "nginx:1.21", imgs[0].Name)
-	})
-
-	t.Run("Helm style image map with no tag", func(t *testing.T) {
-		yaml := map[string]interface{}{
-			"image": map[string]interface{}{
-				"repository": "nginx",
-			},
-		}
-		imgs := svc.FindContainerImages(yaml)
-		require.Len(t, imgs, 1)
-		require.Equal(t, "nginx:latest", imgs[0].Name)
-	})
-
-	t.Run("Direct image string", func(t *testing.T) {
-		yaml := map[string]interface{}{
-			"image": "alpine:3.18",
-			"name":  "test-container",
-		}
-		imgs := svc.FindContainerImages(yaml)
-		require.Len(t, imgs, 1)
-		require.Equal(t, "alpine:3.18", imgs[0].Name)
-		require.Equal(t, "test-container", imgs[0].Container)
-	})
-
-	t.Run("Nested images", func(t *testing.T) {
-		yaml := map[string]interface{}{
-			"spec": map[string]interface{}{
-				"containers": []interface{}{
-					map[string]interface{}{
-						"image": "busybox:1.36",
-					},
-				},
-			},
-		}
-		imgs := svc.FindContainerImages(yaml)
-		require.Len(t, imgs, 1)
-		require.Equal(t, "busybox:1.36", imgs[0].Name)
-	})
-}
-
 func TestFormatSize(t *testing.T) {
 	testCases := []struct {
 		size     int64
@@ -142,14 +96,18 @@ func TestGetDockerHubResponse(t *testing.T) {
 	service.SetDockerHubBaseURL(server.URL)
 
 	// Test official image
-	body, err := service.GetDockerHubResponse("nginx:latest")
+	body, err := service.GetDockerHubResponse(context.Background(), "nginx:latest")
 	require.NoError(t, err)
 	require.NotEmpty(t, body)
 
 	// Test custom image
-	body, err = service.GetDockerHubResponse("custom/nginx:latest")
+	body, err = service.GetDockerHubResponse(context.Background(), "custom/nginx:latest")
 	require.NoError(t, err)
 	require.NotEmpty(t, body)
+
+	// Test image from another registry
+	_, err = service.GetDockerHubResponse(context.Background(), "ghcr.io/custom/nginx:latest")
+	require.Error(t, err)
 }
 
 func TestGetImageSize(t *testing.T) {
@@ -170,21 +128,321 @@ func TestGetImageSize(t *testing.T) {
 	})
 }
 
+// digestFor returns a well-formed sha256 digest made of the given hex character
+func digestFor(c string) string {
+	return "sha256:" + strings.Repeat(c, 64)
+}
+
+// newFakeRegistry creates a test server serving the given manifests by
+// "<repository>/manifests/<reference>" path with their media types
+func newFakeRegistry(t *testing.T, manifests map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.Header.Get("Accept"), mediaTypeOCIIndex)
+
+		body, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal([]byte(body), &m)
+		if m.MediaType != "" {
+			w.Header().Set("Content-Type", m.MediaType)
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestGetImageLayers(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]string{
+		"library/nginx/manifests/" + digestFor("1"): `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+			"layers": [{"digest": "sha256:a"}, {"digest": "sha256:b"}, {"digest": "sha256:c"}]
+		}`,
+		"library/nginx/manifests/" + digestFor("2"): `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"layers": [{"digest": "sha256:a"}, {"digest": "sha256:b"}]
+		}`,
+		"library/nginx/manifests/1.0": `{
+			"schemaVersion": 1,
+			"fsLayers": [{"blobSum": "sha256:a"}, {"blobSum": "sha256:b"}, {"blobSum": "sha256:c"}, {"blobSum": "sha256:d"}]
+		}`,
+		"library/nginx/manifests/" + digestFor("3"): `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.oci.image.index.v1+json",
+			"manifests": [
+				{"digest": "` + digestFor("4") + `", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+				{"digest": "` + digestFor("2") + `", "platform": {"os": "linux", "architecture": "amd64"}}
+			]
+		}`,
+		"library/nginx/manifests/" + digestFor("4"): `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"layers": [{"digest": "sha256:a"}]
+		}`,
+	})
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	t.Run("docker v2 schema 2", func(t *testing.T) {
+		layers, err := service.GetImageLayers(context.Background(), "nginx@"+digestFor("1"))
+		require.NoError(t, err)
+		require.Equal(t, 3, layers)
+	})
+
+	t.Run("oci image manifest", func(t *testing.T) {
+		layers, err := service.GetImageLayers(context.Background(), "nginx@"+digestFor("2"))
+		require.NoError(t, err)
+		require.Equal(t, 2, layers)
+	})
+
+	t.Run("docker v2 schema 1 by tag", func(t *testing.T) {
+		layers, err := service.GetImageLayers(context.Background(), "nginx:1.0")
+		require.NoError(t, err)
+		require.Equal(t, 4, layers)
+	})
+
+	t.Run("oci image index", func(t *testing.T) {
+		layers, err := service.GetImageLayers(context.Background(), "nginx@"+digestFor("3"))
+		require.NoError(t, err)
+		require.Equal(t, 2, layers)
+	})
+
+	t.Run("oci image index with requested platform", func(t *testing.T) {
+		armService := NewHELMService()
+		armService.SetRegistryBaseURL(registry.URL)
+		require.NoError(t, armService.SetPlatform("linux/arm64"))
+
+		layers, err := armService.GetImageLayers(context.Background(), "nginx@"+digestFor("3"))
+		require.NoError(t, err)
+		require.Equal(t, 1, layers)
+	})
+
+	t.Run("missing platform", func(t *testing.T) {
+		s390xService := NewHELMService()
+		s390xService.SetRegistryBaseURL(registry.URL)
+		require.NoError(t, s390xService.SetPlatform("linux/s390x"))
+
+		_, err := s390xService.GetImageLayers(context.Background(), "nginx@"+digestFor("3"))
+		require.Error(t, err)
+	})
+
+	t.Run("unknown manifest", func(t *testing.T) {
+		_, err := service.GetImageLayers(context.Background(), "nginx@"+digestFor("5"))
+		require.Error(t, err)
+	})
+
+	t.Run("invalid image name", func(t *testing.T) {
+		_, err := service.GetImageLayers(context.Background(), ":latest")
+		require.Error(t, err)
+	})
+}
+
+func TestSetPlatform(t *testing.T) {
+	service := NewHELMService()
+	require.NoError(t, service.SetPlatform("linux/arm/v7"))
+	require.Equal(t, "linux/arm/v7", service.platform.String())
+
+	require.Error(t, service.SetPlatform("linux"))
+	require.Error(t, service.SetPlatform("linux/arm/v7/extra"))
+}
+
 func TestGetImageInfo(t *testing.T) {
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		response := map[string]interface{}{
-			"full_size": 104857600, // 100MB
+	registry := newFakeRegistry(t, map[string]string{
+		"library/nginx/manifests/latest": `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+			"layers": [{"digest": "sha256:a", "size": 52428800}, {"digest": "sha256:b", "size": 52428800}, {"digest": "sha256:c"}]
+		}`,
+		"library/legacy/manifests/latest": `{
+			"schemaVersion": 1,
+			"fsLayers": [{"blobSum": "sha256:a"}, {"blobSum": "sha256:b"}]
+		}`,
+		"team/svc/manifests/2": `{
+			"schemaVersion": 2,
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"layers": [{"digest": "sha256:a", "size": 2048}]
+		}`,
+	})
+	defer registry.Close()
+
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/repositories/library/legacy/tags/latest", r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"full_size": 1024 * 1024 * 10, // 10MB
+		})
+	}))
+	defer hub.Close()
+
+	service := NewHELMService()
+	service.SetDockerHubBaseURL(hub.URL)
+	service.SetRegistryBaseURL(registry.URL)
+
+	t.Run("size from manifest layers", func(t *testing.T) {
+		size, layers, err := service.GetImageInfo(context.Background(), "nginx:latest")
+		require.NoError(t, err)
+		require.Equal(t, "100.00 MB", size)
+		require.Equal(t, 3, layers)
+	})
+
+	t.Run("Docker Hub size fallback", func(t *testing.T) {
+		size, layers, err := service.GetImageInfo(context.Background(), "legacy")
+		require.NoError(t, err)
+		require.Equal(t, "10.00 MB", size)
+		require.Equal(t, 2, layers)
+	})
+
+	t.Run("Docker Hub size fallback disabled", func(t *testing.T) {
+		noHubService := NewHELMService()
+		noHubService.SetRegistryBaseURL(registry.URL)
+		noHubService.SetDockerHubMetadata(false)
+
+		_, _, err := noHubService.GetImageInfo(context.Background(), "legacy")
+		require.Error(t, err)
+	})
+
+	t.Run("self-hosted registry", func(t *testing.T) {
+		host := strings.TrimPrefix(registry.URL, "http://")
+		service.SetInsecureRegistries(host)
+
+		size, layers, err := service.GetImageInfo(context.Background(), host+"/team/svc:2")
+		require.NoError(t, err)
+		require.Equal(t, "2.00 KB", size)
+		require.Equal(t, 1, layers)
+	})
+}
+
+func TestGetImageInfo_Concurrency(t *testing.T) {
+	manifest := `{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"layers": [{"digest": "sha256:a", "size": 1024}]
+	}`
+
+	var requests, inFlight, maxInFlight int32
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
 		}
-		json.NewEncoder(w).Encode(response)
+
+		<-release
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(manifest))
 	}))
-	defer server.Close()
+	defer registry.Close()
 
 	service := NewHELMService()
-	service.SetDockerHubBaseURL(server.URL)
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetMaxConcurrentLookups(2)
 
-	size, layers, err := service.GetImageInfo("nginx:latest")
-	require.NoError(t, err)
-	require.Equal(t, "100.00 MB", size)
-	require.Equal(t, 0, layers) // Currently returns 0 as GetImageLayers is not implemented
+	lookup := func(names ...string) {
+		var wg sync.WaitGroup
+		sizes := make([]string, len(names))
+		errs := make([]error, len(names))
+		for i, name := range names {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				sizes[i], _, errs[i] = service.GetImageInfo(context.Background(), name)
+			}(i, name)
+		}
+
+		// Let every lookup start before the registry answers
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&requests) > 0 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for i := range names {
+			require.NoError(t, errs[i])
+			require.Equal(t, "1.00 KB", sizes[i])
+		}
+	}
+
+	t.Run("same image shares one lookup", func(t *testing.T) {
+		lookup("nginx:1.25", "nginx:1.25", "docker.io/library/nginx:1.25", "index.docker.io/library/nginx:1.25")
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("global limit", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		release = make(chan struct{})
+		lookup("a:1", "b:1", "c:1", "d:1", "e:1")
+		require.Equal(t, int32(5), atomic.LoadInt32(&requests))
+		require.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+	})
+}
+
+func TestGetImageInfo_Context(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "mediaType": "` + mediaTypeOCIManifest + `", "layers": [{"digest": "sha256:a", "size": 1024}]}`))
+	}))
+	defer registry.Close()
+	defer close(release)
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := service.GetImageInfo(ctx, "nginx:slow")
+		var imageErr *models.ImageError
+		require.ErrorAs(t, err, &imageErr)
+		require.Equal(t, models.ImageErrorTimeout, imageErr.Code)
+	})
+
+	t.Run("caller going away does not fail a shared lookup", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		leaving, leave := context.WithCancel(context.Background())
+
+		leftErr := make(chan error, 1)
+		go func() {
+			_, _, err := service.GetImageInfo(leaving, "nginx:1.25")
+			leftErr <- err
+		}()
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 1 }, time.Second, time.Millisecond)
+
+		var size string
+		done := make(chan error, 1)
+		go func() {
+			var err error
+			size, _, err = service.GetImageInfo(context.Background(), "nginx:1.25")
+			done <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		leave()
+		require.Error(t, <-leftErr)
+
+		release <- struct{}{}
+		require.NoError(t, <-done)
+		require.Equal(t, "1.00 KB", size)
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
 }
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPClient creates the client shared by all upstream requests:
+// connectTimeout bounds dialing and the TLS handshake, readTimeout the wait
+// for response headers. Whole requests are bounded by their context.
+func newHTTPClient(connectTimeout, readTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = readTimeout
+	return &http.Client{Transport: transport}
+}
+
+// SetHTTPTimeouts sets the connect and read timeouts of upstream requests
+func (s *HELMService) SetHTTPTimeouts(connectTimeout, readTimeout time.Duration) {
+	s.httpClient = newHTTPClient(connectTimeout, readTimeout)
+}
+
+// httpGet sends a GET request with the shared client
+func (s *HELMService) httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.httpClient.Do(req)
+}
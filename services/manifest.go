@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Manifest media types supported by the registry client
+const (
+	mediaTypeDockerManifestV1       = "application/vnd.docker.distribution.manifest.v1+json"
+	mediaTypeDockerManifestV1Signed = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	mediaTypeDockerManifestV2       = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest            = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex               = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifestAcceptHeader lists every manifest format we know how to parse
+var manifestAcceptHeader = strings.Join([]string{
+	mediaTypeOCIIndex,
+	mediaTypeDockerManifestList,
+	mediaTypeOCIManifest,
+	mediaTypeDockerManifestV2,
+	mediaTypeDockerManifestV1Signed,
+	mediaTypeDockerManifestV1,
+}, ", ")
+
+// platform describes the target OS/architecture of an image
+type platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// parsePlatform parses a platform string in "os/arch[/variant]" form
+func parsePlatform(s string) (platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+	}
+
+	p := platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// String returns the platform in "os/arch[/variant]" form
+func (p platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// matches reports whether p satisfies the wanted platform; an empty
+// wanted variant matches any variant
+func (p platform) matches(want platform) bool {
+	if p.OS != want.OS || p.Architecture != want.Architecture {
+		return false
+	}
+	return want.Variant == "" || p.Variant == want.Variant
+}
+
+// descriptor references a blob or manifest by digest
+type descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *platform `json:"platform,omitempty"`
+}
+
+// manifest holds the fields of every supported manifest format;
+// only the ones matching the media type are populated
+type manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+
+	// Docker v2 schema 2 and OCI image manifest
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+
+	// Docker manifest list and OCI image index
+	Manifests []descriptor `json:"manifests"`
+
+	// Docker v2 schema 1
+	FSLayers []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+
+	// digest is the digest of the manifest itself, and indexDigest and
+	// platform the digest of the image index it was selected from and its
+	// platform entry, if any
+	digest      string
+	indexDigest string
+	platform    *platform
+}
+
+// imageDigest returns the digest the image reference resolved to: the
+// digest of the image index for multi-platform images
+func (m *manifest) imageDigest() string {
+	if m.indexDigest != "" {
+		return m.indexDigest
+	}
+	return m.digest
+}
+
+// parseManifest decodes a manifest body, using contentType when the
+// document itself does not declare a media type and falling back to the
+// document shape when neither is a known manifest format
+func parseManifest(body []byte, contentType string) (*manifest, error) {
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %w", err)
+	}
+
+	if m.MediaType == "" {
+		m.MediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	if !isManifestMediaType(m.MediaType) {
+		switch {
+		case m.SchemaVersion == 1:
+			m.MediaType = mediaTypeDockerManifestV1
+		case m.Manifests != nil:
+			m.MediaType = mediaTypeOCIIndex
+		default:
+			m.MediaType = mediaTypeOCIManifest
+		}
+	}
+
+	return &m, nil
+}
+
+// isManifestMediaType reports whether mediaType is one of the supported manifest formats
+func isManifestMediaType(mediaType string) bool {
+	switch mediaType {
+	case mediaTypeDockerManifestV1, mediaTypeDockerManifestV1Signed, mediaTypeDockerManifestV2,
+		mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex:
+		return true
+	}
+	return false
+}
+
+// isIndex reports whether the manifest is a multi-platform index
+func (m *manifest) isIndex() bool {
+	return m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerManifestList
+}
+
+// layerCount returns the number of layers of a single-platform manifest
+func (m *manifest) layerCount() (int, error) {
+	switch m.MediaType {
+	case mediaTypeDockerManifestV1, mediaTypeDockerManifestV1Signed:
+		return len(m.FSLayers), nil
+	case mediaTypeDockerManifestV2, mediaTypeOCIManifest:
+		return len(m.Layers), nil
+	}
+	return 0, fmt.Errorf("unsupported manifest media type: %s", m.MediaType)
+}
+
+// totalSize returns the compressed image size as the sum of its layer sizes.
+// Schema 1 manifests carry no sizes, so they report an error.
+func (m *manifest) totalSize() (int64, error) {
+	switch m.MediaType {
+	case mediaTypeDockerManifestV2, mediaTypeOCIManifest:
+		var size int64
+		for _, l := range m.Layers {
+			size += l.Size
+		}
+		return size, nil
+	}
+	return 0, fmt.Errorf("manifest type %s does not include layer sizes", m.MediaType)
+}
+
+// selectPlatform picks the index entry matching the wanted platform
+func (m *manifest) selectPlatform(want platform) (descriptor, error) {
+	for _, d := range m.Manifests {
+		if d.Platform != nil && d.Platform.matches(want) {
+			return d, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no manifest found for platform %s", want)
+}
+
+// selectWanted picks the first index entry matching one of the wanted
+// platforms, or the first entry of a known platform when all are wanted
+func (m *manifest) selectWanted(wanted []platform, all bool) (descriptor, bool) {
+	for _, want := range wanted {
+		if d, err := m.selectPlatform(want); err == nil {
+			return d, true
+		}
+	}
+	if all {
+		for _, d := range m.Manifests {
+			if d.Platform != nil && d.Platform.OS != "" && d.Platform.OS != "unknown" {
+				return d, true
+			}
+		}
+	}
+	return descriptor{}, false
+}
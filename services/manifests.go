@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"helm-viewer/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAMLDocuments parses every document of a YAML stream, skipping empty
+// ones; the items of Kubernetes lists such as `kubectl get -o yaml` output
+// become documents of their own
+func parseYAMLDocuments(data []byte) ([]models.YAMLDocument, error) {
+	var docs []models.YAMLDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		expanded, err := expandList(&node)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, expanded...)
+	}
+	return docs, nil
+}
+
+// expandList returns the documents of a node: the items of a list, expanded
+// in turn, or the node itself
+func expandList(node *yaml.Node) ([]models.YAMLDocument, error) {
+	if items := listItems(node); items != nil {
+		var docs []models.YAMLDocument
+		for _, item := range items {
+			expanded, err := expandList(item)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, expanded...)
+		}
+		return docs, nil
+	}
+
+	var content any
+	if err := node.Decode(&content); err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, nil
+	}
+	return []models.YAMLDocument{{Content: content, Node: node}}, nil
+}
+
+// listItems returns the items of a Kubernetes list: a resource of kind List,
+// or of a typed list kind such as PodList, with an items sequence
+func listItems(node *yaml.Node) []*yaml.Node {
+	root := resolveNode(node)
+	if !isManifest(root) || !strings.HasSuffix(scalarValue(mappingValue(root, "kind")), "List") {
+		return nil
+	}
+	items := mappingValue(root, "items")
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return items.Content
+}
+
+// isManifest reports whether a node is a Kubernetes resource, with an
+// apiVersion and a kind
+func isManifest(node *yaml.Node) bool {
+	root := resolveNode(node)
+	return scalarValue(mappingValue(root, "apiVersion")) != "" && scalarValue(mappingValue(root, "kind")) != ""
+}
+
+// manifestResource returns the resource a Kubernetes manifest describes, or
+// nil for other content
+func manifestResource(root *yaml.Node) *models.Resource {
+	if !isManifest(root) {
+		return nil
+	}
+	metadata := mappingValue(root, "metadata")
+	return &models.Resource{
+		APIVersion: scalarValue(mappingValue(root, "apiVersion")),
+		Kind:       scalarValue(mappingValue(root, "kind")),
+		Namespace:  scalarValue(mappingValue(metadata, "namespace")),
+		Name:       scalarValue(mappingValue(metadata, "name")),
+	}
+}
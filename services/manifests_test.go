@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const manifestBundle = `# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+---
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Pod
+    metadata:
+      name: cache
+    spec:
+      containers:
+        - name: redis
+          image: redis:7
+  - apiVersion: batch/v1
+    kind: Job
+    metadata:
+      name: migrate
+      namespace: prod
+    spec:
+      template:
+        spec:
+          containers:
+            - name: migrate
+              image: org/migrate:2.0
+`
+
+func TestParseYAMLDocuments(t *testing.T) {
+	docs, err := parseYAMLDocuments([]byte(manifestBundle))
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+
+	var kinds []string
+	for _, doc := range docs {
+		kinds = append(kinds, doc.Content.(map[string]any)["kind"].(string))
+	}
+	require.Equal(t, []string{"Deployment", "Pod", "Job"}, kinds)
+
+	_, err = parseYAMLDocuments([]byte("a: b\n---\n: [\n"))
+	require.Error(t, err)
+}
+
+func TestLoadAndParseYAML_Manifests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(manifestBundle))
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	docs, err := service.LoadAndParseYAML(context.Background(), server.URL+"/bundle.yaml", models.LoadOptions{})
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+
+	var images []models.ContainerImage
+	for _, doc := range docs {
+		require.Equal(t, "bundle.yaml", doc.Source)
+		require.False(t, doc.Values)
+		images = append(images, service.FindDocumentImages(doc)...)
+	}
+	require.Len(t, images, 3)
+
+	require.Equal(t, "nginx:1.25", images[0].Name)
+	require.Equal(t, &models.Resource{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "prod", Name: "web"}, images[0].Resource)
+	require.Equal(t, "Deployment/web", images[0].Workload)
+	require.Equal(t, "spec.template.spec.containers[0].image", images[0].Path)
+	require.Equal(t, 12, images[0].Line)
+	require.Empty(t, images[0].Set)
+
+	require.Equal(t, "redis:7", images[1].Name)
+	require.Equal(t, &models.Resource{APIVersion: "v1", Kind: "Pod", Name: "cache"}, images[1].Resource)
+	require.Equal(t, 25, images[1].Line)
+
+	require.Equal(t, "org/migrate:2.0", images[2].Name)
+	require.Equal(t, &models.Resource{APIVersion: "batch/v1", Kind: "Job", Namespace: "prod", Name: "migrate"}, images[2].Resource)
+}
+
+func TestLoadAndParseYAML_ValuesDocuments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image: nginx:1.25\n---\nsidecar:\n  image: busybox:1.36\n"))
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	docs, err := service.LoadAndParseYAML(context.Background(), server.URL+"/values.yaml", models.LoadOptions{Set: []string{"image=nginx:1.27"}})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	// User values override the first values document only
+	require.True(t, docs[0].Values)
+	require.Equal(t, map[string]any{"image": "nginx:1.27"}, docs[0].Content)
+	require.True(t, docs[1].Values)
+	require.Equal(t, map[string]any{"sidecar": map[string]any{"image": "busybox:1.36"}}, docs[1].Content)
+	require.Nil(t, service.FindDocumentImages(docs[1])[0].Resource)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"helm-viewer/reference"
+)
+
+// ociScheme is the URL scheme of charts stored in OCI registries
+const ociScheme = "oci://"
+
+// Media types of Helm charts stored as OCI artifacts
+const (
+	mediaTypeHelmChartContent       = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	mediaTypeHelmChartContentLegacy = "application/tar+gzip"
+)
+
+// isOCIChartURL reports whether url references a chart in an OCI registry
+func isOCIChartURL(url string) bool {
+	return strings.HasPrefix(url, ociScheme)
+}
+
+// pullOCIChart pulls a chart from an OCI registry, e.g.
+// "oci://ghcr.io/org/charts/mychart:1.2.3", and returns its archive
+func (s *HELMService) pullOCIChart(ctx context.Context, url string) ([]byte, error) {
+	ref, err := reference.Parse(strings.TrimPrefix(url, ociScheme))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI chart reference: %w", err)
+	}
+
+	m, err := s.getManifest(ctx, ref, ref.Identifier())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chart manifest: %w", err)
+	}
+	if m.isIndex() {
+		return nil, fmt.Errorf("%s is an image index, not a chart", url)
+	}
+
+	for _, layer := range m.Layers {
+		if layer.MediaType != mediaTypeHelmChartContent && layer.MediaType != mediaTypeHelmChartContentLegacy {
+			continue
+		}
+
+		archive, err := s.getBlob(ctx, ref, layer.Digest, maxDownloadSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download chart: %w", err)
+		}
+		return archive, nil
+	}
+
+	return nil, fmt.Errorf("%s has no %s layer", url, mediaTypeHelmChartContent)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeChartRegistry serves a chart artifact at team/charts/mychart:1.2.3
+// behind a bearer token challenge; blob is served for the chart layer digest
+func newFakeChartRegistry(t *testing.T, chart, blob []byte) *httptest.Server {
+	t.Helper()
+
+	sum := sha256.Sum256(chart)
+	chartDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			w.Write([]byte(`{"token": "chart-token"}`))
+			return
+		case r.Header.Get("Authorization") != "Bearer chart-token":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/team/charts/mychart/manifests/1.2.3":
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			fmt.Fprintf(w, `{
+				"schemaVersion": 2,
+				"config": {"mediaType": "application/vnd.cncf.helm.config.v1+json", "digest": "sha256:c"},
+				"layers": [{"mediaType": %q, "digest": %q, "size": %d}]
+			}`, mediaTypeHelmChartContent, chartDigest, len(chart))
+		case "/v2/team/charts/mychart/blobs/" + chartDigest:
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestLoadAndParseYAML_OCIChart(t *testing.T) {
+	chart := buildChartArchive(t, map[string]string{
+		"mychart/values.yaml": "image:\n  repository: nginx\n  tag: \"1.25\"\n",
+	})
+	registry := newFakeChartRegistry(t, chart, chart)
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	service := NewHELMService()
+	service.SetInsecureRegistries(host)
+
+	docs, err := service.LoadAndParseYAML(context.Background(), "oci://"+host+"/team/charts/mychart:1.2.3", models.LoadOptions{})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "mychart/values.yaml", docs[0].Source)
+
+	_, err = service.LoadAndParseYAML(context.Background(), "oci://"+host+"/team/charts/mychart:9.9.9", models.LoadOptions{})
+	require.Error(t, err)
+
+	_, err = service.LoadAndParseYAML(context.Background(), "oci://"+host+"/Invalid", models.LoadOptions{})
+	require.Error(t, err)
+}
+
+func TestLoadAndParseYAML_OCIChartDigestMismatch(t *testing.T) {
+	chart := buildChartArchive(t, map[string]string{
+		"mychart/values.yaml": "image: nginx\n",
+	})
+	tampered := buildChartArchive(t, map[string]string{
+		"mychart/values.yaml": "image: evil\n",
+	})
+	registry := newFakeChartRegistry(t, chart, tampered)
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	service := NewHELMService()
+	service.SetInsecureRegistries(host)
+
+	_, err := service.LoadAndParseYAML(context.Background(), "oci://"+host+"/team/charts/mychart:1.2.3", models.LoadOptions{})
+	require.ErrorContains(t, err, "digest mismatch")
+}
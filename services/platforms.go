@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+)
+
+// platformEntry is a platform of an image and the digest of its manifest;
+// image is set when the size and layer count are already known
+type platformEntry struct {
+	platform platform
+	digest   string
+	image    *cachedImage
+}
+
+// platformKey is the cache key of the size and layer count of a platform
+// manifest
+func platformKey(ref reference.Reference, digest string) string {
+	return "platform:" + ref.Registry + "/" + ref.Path() + "@" + digest
+}
+
+// inspectPlatforms fills in the size and layer count of the images of the
+// wanted platforms of an image, every platform for "*", and the wanted
+// platforms the image lacks. Multi-platform images are resolved through their
+// index; the platform of single-platform images comes from their
+// configuration.
+func (s *HELMService) inspectPlatforms(ctx context.Context, ref reference.Reference, metadata *models.ImageMetadata, wanted []string) error {
+	platforms, all, err := parseWantedPlatforms(wanted)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.platformEntries(ctx, ref, metadata)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]bool, len(entries))
+	for _, want := range platforms {
+		found := false
+		for i, entry := range entries {
+			if entry.platform.matches(want) {
+				selected[i], found = true, true
+			}
+		}
+		if !found {
+			metadata.MissingPlatforms = append(metadata.MissingPlatforms, want.String())
+		}
+	}
+	s.reportConfiguredPlatform(metadata, entries)
+
+	for i, entry := range entries {
+		if !all && !selected[i] {
+			continue
+		}
+		image := entry.image
+		if image == nil {
+			if image, err = s.platformImage(ctx, ref, entry.digest); err != nil {
+				return err
+			}
+		}
+		metadata.Platforms = append(metadata.Platforms, models.PlatformMetadata{
+			Platform:        entry.platform.String(),
+			Digest:          entry.digest,
+			CompressedBytes: image.Size,
+			LayerCount:      image.Layers,
+		})
+	}
+	return nil
+}
+
+// reportConfiguredPlatform adds the configured platform to the missing
+// platforms when the image has platforms but not that one
+func (s *HELMService) reportConfiguredPlatform(metadata *models.ImageMetadata, entries []platformEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		if entry.platform.matches(s.platform) {
+			return
+		}
+	}
+	for _, missing := range metadata.MissingPlatforms {
+		if missing == s.platform.String() {
+			return
+		}
+	}
+	metadata.MissingPlatforms = append(metadata.MissingPlatforms, s.platform.String())
+}
+
+// parseWantedPlatforms parses the platforms of LookupOptions.Platforms;
+// all is set when every platform is wanted
+func parseWantedPlatforms(wanted []string) (platforms []platform, all bool, err error) {
+	for _, w := range wanted {
+		if w == models.AllPlatforms {
+			all = true
+			continue
+		}
+		p, err := parsePlatform(w)
+		if err != nil {
+			return nil, false, err
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, all, nil
+}
+
+// platformEntries returns the platforms of an image: the entries of its index,
+// without attestations and other entries of unknown platform, or the platform
+// of a single-platform image
+func (s *HELMService) platformEntries(ctx context.Context, ref reference.Reference, metadata *models.ImageMetadata) ([]platformEntry, error) {
+	if metadata.Digest == metadata.ManifestDigest {
+		p, err := parsePlatform(metadata.Platform)
+		if err != nil {
+			return nil, nil
+		}
+		image := &cachedImage{Size: metadata.Bytes, Layers: metadata.Layers}
+		return []platformEntry{{platform: p, digest: metadata.ManifestDigest, image: image}}, nil
+	}
+
+	index, err := s.getManifest(ctx, ref, metadata.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image index: %w", err)
+	}
+
+	var entries []platformEntry
+	for _, d := range index.Manifests {
+		if d.Platform == nil || d.Platform.OS == "" || d.Platform.OS == "unknown" {
+			continue
+		}
+		entry := platformEntry{platform: *d.Platform, digest: d.Digest}
+		if d.Digest == metadata.ManifestDigest {
+			entry.image = &cachedImage{Size: metadata.Bytes, Layers: metadata.Layers}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// platformImage returns the size and layer count of a platform manifest,
+// cached by digest
+func (s *HELMService) platformImage(ctx context.Context, ref reference.Reference, digest string) (*cachedImage, error) {
+	var image cachedImage
+	if s.cache.load(platformKey(ref, digest), &image) {
+		return &image, nil
+	}
+
+	m, err := s.getManifest(ctx, ref, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get platform manifest: %w", err)
+	}
+	if image.Layers, err = m.layerCount(); err != nil {
+		return nil, fmt.Errorf("failed to get platform layers: %w", err)
+	}
+	if image.Size, err = m.totalSize(); err != nil {
+		return nil, fmt.Errorf("failed to get platform size: %w", err)
+	}
+
+	image.Fetched = s.now()
+	s.cache.store(platformKey(ref, digest), image)
+	return &image, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetImageMetadata_Platforms(t *testing.T) {
+	config := `{"os": "linux", "architecture": "amd64"}`
+	platformManifest := func(config string, sizes ...string) string {
+		layers := make([]string, len(sizes))
+		for i, size := range sizes {
+			layers[i] = `{"digest": "` + digestFor(string(rune('a'+i))) + `", "size": ` + size + `}`
+		}
+		return `{"schemaVersion": 2, "mediaType": "` + mediaTypeOCIManifest + `", "config": {"digest": "` + sha256Digest([]byte(config)) + `"}, "layers": [` + strings.Join(layers, ", ") + `]}`
+	}
+	amd64 := platformManifest(config, "1000", "2000")
+	arm64 := platformManifest(config, "3000", "4000", "5000")
+	index := `{
+		"schemaVersion": 2,
+		"mediaType": "` + mediaTypeOCIIndex + `",
+		"manifests": [
+			{"digest": "` + sha256Digest([]byte(amd64)) + `", "platform": {"os": "linux", "architecture": "amd64"}},
+			{"digest": "` + sha256Digest([]byte(arm64)) + `", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			{"digest": "` + digestFor("f") + `", "platform": {"os": "unknown", "architecture": "unknown"}}
+		]
+	}`
+	single := platformManifest(config, "700")
+	arm64Index := `{
+		"schemaVersion": 2,
+		"mediaType": "` + mediaTypeOCIIndex + `",
+		"manifests": [
+			{"digest": "` + sha256Digest([]byte(arm64)) + `", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}}
+		]
+	}`
+
+	bodies := map[string]string{
+		"manifests/multi":                               index,
+		"manifests/" + sha256Digest([]byte(index)):      index,
+		"manifests/" + sha256Digest([]byte(amd64)):      amd64,
+		"manifests/" + sha256Digest([]byte(arm64)):      arm64,
+		"manifests/single":                              single,
+		"manifests/arm64only":                           arm64Index,
+		"manifests/" + sha256Digest([]byte(arm64Index)): arm64Index,
+		"blobs/" + sha256Digest([]byte(config)):         config,
+	}
+	var mu sync.Mutex
+	requests := map[string]int{}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/library/app/")
+		mu.Lock()
+		requests[path]++
+		mu.Unlock()
+
+		body, ok := bodies[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+
+	t.Run("requested platforms", func(t *testing.T) {
+		metadata, err := service.GetImageMetadata(context.Background(), "app:multi", models.LookupOptions{Platforms: []string{"linux/arm64", "linux/s390x"}})
+		require.NoError(t, err)
+		require.Equal(t, int64(3000), metadata.Bytes)
+		require.Equal(t, []models.PlatformMetadata{
+			{Platform: "linux/arm64/v8", Digest: sha256Digest([]byte(arm64)), CompressedBytes: 12000, LayerCount: 3},
+		}, metadata.Platforms)
+		require.Equal(t, []string{"linux/s390x"}, metadata.MissingPlatforms)
+	})
+
+	t.Run("every platform", func(t *testing.T) {
+		metadata, err := service.GetImageMetadata(context.Background(), "app:multi", models.LookupOptions{Platforms: []string{models.AllPlatforms}})
+		require.NoError(t, err)
+		require.Equal(t, []models.PlatformMetadata{
+			{Platform: "linux/amd64", Digest: sha256Digest([]byte(amd64)), CompressedBytes: 3000, LayerCount: 2},
+			{Platform: "linux/arm64/v8", Digest: sha256Digest([]byte(arm64)), CompressedBytes: 12000, LayerCount: 3},
+		}, metadata.Platforms)
+		require.Empty(t, metadata.MissingPlatforms)
+
+		// Platform manifests are looked up once; the default platform comes
+		// with the image itself
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, 1, requests["manifests/"+sha256Digest([]byte(arm64))])
+		require.Equal(t, 1, requests["manifests/"+sha256Digest([]byte(amd64))])
+	})
+
+	t.Run("single-platform image", func(t *testing.T) {
+		metadata, err := service.GetImageMetadata(context.Background(), "app:single", models.LookupOptions{Platforms: []string{"linux/amd64", "linux/arm64"}})
+		require.NoError(t, err)
+		require.Equal(t, []models.PlatformMetadata{
+			{Platform: "linux/amd64", Digest: sha256Digest([]byte(single)), CompressedBytes: 700, LayerCount: 1},
+		}, metadata.Platforms)
+		require.Equal(t, []string{"linux/arm64"}, metadata.MissingPlatforms)
+	})
+
+	t.Run("index without the configured platform", func(t *testing.T) {
+		metadata, err := service.GetImageMetadata(context.Background(), "app:arm64only", models.LookupOptions{Platforms: []string{"linux/arm64"}})
+		require.NoError(t, err)
+		require.Equal(t, int64(12000), metadata.Bytes)
+		require.Equal(t, 3, metadata.Layers)
+		require.Equal(t, "linux/arm64/v8", metadata.Platform)
+		require.Equal(t, []models.PlatformMetadata{
+			{Platform: "linux/arm64/v8", Digest: sha256Digest([]byte(arm64)), CompressedBytes: 12000, LayerCount: 3},
+		}, metadata.Platforms)
+		require.Equal(t, []string{"linux/amd64"}, metadata.MissingPlatforms)
+
+		// Without platforms the configured platform is still required
+		_, err = service.GetImageMetadata(context.Background(), "app:arm64only", models.LookupOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid platform", func(t *testing.T) {
+		_, err := service.GetImageMetadata(context.Background(), "app:multi", models.LookupOptions{Platforms: []string{"linux"}})
+		require.Error(t, err)
+	})
+}
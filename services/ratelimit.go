@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"helm-viewer/config"
+	"helm-viewer/models"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiters throttles registry requests: with a token bucket per
+// registry, and with the quota registries report in their ratelimit-limit
+// and ratelimit-remaining headers, tracked per registry and credential
+type rateLimiters struct {
+	mu       sync.Mutex
+	limits   map[string]config.RateLimit
+	buckets  map[string]*rate.Limiter
+	quotas   map[quotaKey]*registryQuota
+	lowQuota int
+}
+
+// quotaKey identifies the quota of a credential on a registry
+type quotaKey struct {
+	registry   string
+	credential string
+}
+
+// registryQuota is the last quota reported by a registry. While it is low,
+// requests are paced to spread what is left over the quota window; once it
+// is exhausted, requests fail until resetAt.
+type registryQuota struct {
+	limit     int
+	remaining int
+	window    time.Duration
+	updated   time.Time
+	resetAt   time.Time
+	pacer     *rate.Limiter
+}
+
+// newRateLimiters creates rate limiters with token buckets per registry
+func newRateLimiters(limits map[string]config.RateLimit, lowQuota int) *rateLimiters {
+	return &rateLimiters{
+		limits:   limits,
+		buckets:  map[string]*rate.Limiter{},
+		quotas:   map[quotaKey]*registryQuota{},
+		lowQuota: lowQuota,
+	}
+}
+
+// SetRateLimits sets the token buckets of registries and the remaining quota
+// below which requests are paced
+func (s *HELMService) SetRateLimits(limits map[string]config.RateLimit, lowQuota int) {
+	s.rateLimits = newRateLimiters(limits, lowQuota)
+}
+
+// wait blocks until a request to a registry may be sent, queueing behind
+// the registry's token bucket and, while its quota is low, behind the quota
+// pacer. Requests that cannot be sent before ctx is done fail as rate limited.
+func (l *rateLimiters) wait(ctx context.Context, key quotaKey, now time.Time) error {
+	l.mu.Lock()
+	bucket := l.bucket(key.registry)
+	var pacer *rate.Limiter
+	if quota, ok := l.quotas[key]; ok {
+		if quota.remaining == 0 && now.Before(quota.resetAt) {
+			l.mu.Unlock()
+			return &statusError{fmt.Sprintf("quota of %s on %s is exhausted until %s", key.credential, key.registry, quota.resetAt.Format(time.RFC3339)), http.StatusTooManyRequests}
+		}
+		if quota.remaining <= l.lowQuota {
+			pacer = quota.pacer
+		}
+	}
+	l.mu.Unlock()
+
+	for _, limiter := range []*rate.Limiter{bucket, pacer} {
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &statusError{fmt.Sprintf("request to %s throttled: %v", key.registry, err), http.StatusTooManyRequests}
+		}
+	}
+	return nil
+}
+
+// bucket returns the token bucket of a registry, nil when it is not
+// throttled; the lock must be held
+func (l *rateLimiters) bucket(registry string) *rate.Limiter {
+	limit, ok := l.limits[registry]
+	if !ok {
+		return nil
+	}
+	bucket, ok := l.buckets[registry]
+	if !ok {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+		l.buckets[registry] = bucket
+	}
+	return bucket
+}
+
+// update records the quota reported by a response; 429 responses exhaust
+// the quota until their Retry-After, or until the quota window ends
+func (l *rateLimiters) update(key quotaKey, resp *http.Response, now time.Time) {
+	limit, window, hasLimit := parseRateLimitHeader(resp.Header.Get("ratelimit-limit"))
+	remaining, remainingWindow, hasRemaining := parseRateLimitHeader(resp.Header.Get("ratelimit-remaining"))
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	if !hasLimit && !hasRemaining && !limited {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	quota, ok := l.quotas[key]
+	if !ok {
+		quota = &registryQuota{pacer: rate.NewLimiter(rate.Inf, 1)}
+		l.quotas[key] = quota
+	}
+	quota.updated = now
+	if hasLimit {
+		quota.limit = limit
+	}
+	if hasRemaining {
+		quota.remaining = remaining
+	}
+	if window == 0 {
+		window = remainingWindow
+	}
+	if window > 0 {
+		quota.window = window
+	}
+
+	if limited {
+		quota.remaining = 0
+		quota.resetAt = now.Add(quota.window)
+		if after, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok {
+			quota.resetAt = now.Add(after)
+		}
+	}
+
+	// Spread the remaining quota over the window
+	if quota.window > 0 && quota.remaining > 0 {
+		quota.pacer.SetLimitAt(now, rate.Limit(float64(quota.remaining)/quota.window.Seconds()))
+	}
+}
+
+// stats returns the tracked quotas, sorted by registry and credential, with
+// usernames masked
+func (l *rateLimiters) stats() []models.RegistryQuota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := make([]quotaKey, 0, len(l.quotas))
+	for key := range l.quotas {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].registry != keys[j].registry {
+			return keys[i].registry < keys[j].registry
+		}
+		return keys[i].credential < keys[j].credential
+	})
+
+	quotas := []models.RegistryQuota{}
+	for _, key := range keys {
+		quota := l.quotas[key]
+		stat := models.RegistryQuota{
+			Registry:   key.registry,
+			Credential: maskCredential(key.credential),
+			Limit:      quota.limit,
+			Remaining:  quota.remaining,
+			Window:     int64(quota.window.Seconds()),
+			Updated:    quota.updated,
+			Low:        quota.remaining <= l.lowQuota,
+		}
+		if quota.remaining == 0 && !quota.resetAt.IsZero() {
+			resetAt := quota.resetAt
+			stat.ResetAt = &resetAt
+		}
+		if limit, ok := l.limits[key.registry]; ok {
+			stat.Rate, stat.Burst = limit.Rate, limit.Burst
+		}
+		quotas = append(quotas, stat)
+	}
+	return quotas
+}
+
+// parseRateLimitHeader parses a ratelimit header such as "100;w=21600" into
+// its count and window
+func parseRateLimitHeader(header string) (int, time.Duration, bool) {
+	if header == "" {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(header, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count < 0 {
+		return 0, 0, false
+	}
+
+	var window time.Duration
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if seconds, err := strconv.Atoi(value); key == "w" && err == nil && seconds > 0 {
+			window = time.Duration(seconds) * time.Second
+		}
+	}
+	return count, window, true
+}
+
+// anonymousCredential is the credential of requests sent without credentials
+const anonymousCredential = "anonymous"
+
+// credentialName returns the credential requests sent with creds count
+// against: the username, "token" for tokens, or "anonymous"
+func credentialName(creds config.Credentials) string {
+	switch {
+	case creds.Username != "":
+		return creds.Username
+	case creds.IdentityToken != "", creds.RegistryToken != "":
+		return "token"
+	}
+	return anonymousCredential
+}
+
+// maskCredential hides the username of a credential behind a short hash
+// of it, so that quotas can be told apart without revealing usernames
+func maskCredential(credential string) string {
+	if credential == anonymousCredential || credential == "token" {
+		return credential
+	}
+	sum := sha256.Sum256([]byte(credential))
+	return "user-" + hex.EncodeToString(sum[:6])
+}
+
+// RegistryQuotas returns the quotas reported by registries per credential
+func (s *HELMService) RegistryQuotas() []models.RegistryQuota {
+	return s.rateLimits.stats()
+}
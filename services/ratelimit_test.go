@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/config"
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimitHeader(t *testing.T) {
+	count, window, ok := parseRateLimitHeader("100;w=21600")
+	require.True(t, ok)
+	require.Equal(t, 100, count)
+	require.Equal(t, 6*time.Hour, window)
+
+	count, window, ok = parseRateLimitHeader("42")
+	require.True(t, ok)
+	require.Equal(t, 42, count)
+	require.Zero(t, window)
+
+	for _, header := range []string{"", "many", "-1;w=60"} {
+		_, _, ok := parseRateLimitHeader(header)
+		require.False(t, ok, header)
+	}
+}
+
+func TestGetImageInfo_RateLimitQuota(t *testing.T) {
+	manifest := `{"schemaVersion": 2, "mediaType": "` + mediaTypeOCIManifest + `", "layers": [{"digest": "sha256:a", "size": 1024}]}`
+
+	var requests int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("ratelimit-limit", "100;w=21600")
+		if r.URL.Path == "/v2/library/limited/manifests/1.0" {
+			w.Header().Set("ratelimit-remaining", "0;w=21600")
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("ratelimit-remaining", "42;w=21600")
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(manifest))
+	}))
+	defer registry.Close()
+
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetRetryPolicy(3, time.Millisecond, 10*time.Millisecond)
+
+	_, _, err := service.GetImageInfo(context.Background(), "nginx:1.0")
+	require.NoError(t, err)
+
+	quotas := service.RegistryQuotas()
+	require.Len(t, quotas, 1)
+	require.Equal(t, "docker.io", quotas[0].Registry)
+	require.Equal(t, "anonymous", quotas[0].Credential)
+	require.Equal(t, 100, quotas[0].Limit)
+	require.Equal(t, 42, quotas[0].Remaining)
+	require.Equal(t, int64(21600), quotas[0].Window)
+	require.False(t, quotas[0].Low)
+	require.Nil(t, quotas[0].ResetAt)
+
+	// A 429 exhausts the quota: later requests fail without reaching the registry
+	_, _, err = service.GetImageInfo(context.Background(), "limited:1.0")
+	var imageErr *models.ImageError
+	require.ErrorAs(t, err, &imageErr)
+	require.Equal(t, models.ImageErrorRateLimited, imageErr.Code)
+
+	quotas = service.RegistryQuotas()
+	require.Equal(t, 0, quotas[0].Remaining)
+	require.True(t, quotas[0].Low)
+	require.NotNil(t, quotas[0].ResetAt)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *quotas[0].ResetAt, time.Minute)
+
+	before := atomic.LoadInt32(&requests)
+	_, _, err = service.GetImageInfo(context.Background(), "redis:1.0")
+	require.ErrorAs(t, err, &imageErr)
+	require.Equal(t, models.ImageErrorRateLimited, imageErr.Code)
+	require.Equal(t, before, atomic.LoadInt32(&requests))
+}
+
+// countingCredentialsProvider counts credential lookups
+type countingCredentialsProvider struct {
+	lookups int32
+}
+
+func (p *countingCredentialsProvider) Lookup(ctx context.Context, registry string) (config.Credentials, bool, error) {
+	atomic.AddInt32(&p.lookups, 1)
+	return config.Credentials{Username: "user", Password: "secret"}, true, nil
+}
+
+func TestRateLimiters_AnonymousRequests(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ratelimit-remaining", "42;w=21600")
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(`{"schemaVersion": 2, "layers": [{"digest": "sha256:a", "size": 1}]}`))
+	}))
+	defer registry.Close()
+
+	provider := &countingCredentialsProvider{}
+	service := NewHELMService()
+	service.SetRegistryBaseURL(registry.URL)
+	service.SetCredentialsProvider(provider)
+
+	// Requests the registry does not challenge never look up credentials
+	for i := 0; i < 5; i++ {
+		_, err := service.GetImageLayers(context.Background(), "nginx:1.0")
+		require.NoError(t, err)
+	}
+	require.Zero(t, atomic.LoadInt32(&provider.lookups))
+
+	quotas := service.RegistryQuotas()
+	require.Len(t, quotas, 1)
+	require.Equal(t, "anonymous", quotas[0].Credential)
+}
+
+func TestRateLimiters_Credentials(t *testing.T) {
+	require.Equal(t, "anonymous", credentialName(config.Credentials{}))
+	require.Equal(t, "user", credentialName(config.Credentials{Username: "user", Password: "secret"}))
+	require.Equal(t, "token", credentialName(config.Credentials{RegistryToken: "token"}))
+
+	limiters := newRateLimiters(nil, config.DefaultLowQuota)
+	now := time.Now()
+	for credential, remaining := range map[string]string{"anonymous": "3", "user": "150"} {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		resp.Header.Set("ratelimit-remaining", remaining+";w=21600")
+		limiters.update(quotaKey{registry: "docker.io", credential: credential}, resp, now)
+	}
+
+	quotas := limiters.stats()
+	require.Len(t, quotas, 2)
+	require.Equal(t, "anonymous", quotas[0].Credential)
+	require.Equal(t, 3, quotas[0].Remaining)
+	require.True(t, quotas[0].Low)
+	require.Equal(t, maskCredential("user"), quotas[1].Credential)
+	require.Equal(t, 150, quotas[1].Remaining)
+	require.False(t, quotas[1].Low)
+}
+
+func TestRateLimiters_TokenBucket(t *testing.T) {
+	limiters := newRateLimiters(map[string]config.RateLimit{"docker.io": {Rate: 1, Burst: 2}}, config.DefaultLowQuota)
+	key := quotaKey{registry: "docker.io", credential: "anonymous"}
+
+	// The burst goes through, the next request would wait past the deadline
+	for i := 0; i < 2; i++ {
+		require.NoError(t, limiters.wait(context.Background(), key, time.Now()))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := limiters.wait(ctx, key, time.Now())
+	require.Equal(t, models.ImageErrorRateLimited, lookupError(err).Code)
+
+	// Other registries are not throttled
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limiters.wait(context.Background(), quotaKey{registry: "ghcr.io"}, time.Now()))
+	}
+}
+
+func TestRateLimiters_LowQuotaPacing(t *testing.T) {
+	limiters := newRateLimiters(nil, 10)
+	key := quotaKey{registry: "docker.io", credential: "anonymous"}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set("ratelimit-remaining", "50;w=60")
+	limiters.update(key, resp, time.Now())
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limiters.wait(context.Background(), key, time.Now()))
+	}
+
+	// 5 requests left over a minute are spread 12 seconds apart
+	resp.Header.Set("ratelimit-remaining", "5;w=60")
+	limiters.update(key, resp, time.Now())
+	require.NoError(t, limiters.wait(context.Background(), key, time.Now()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Error(t, limiters.wait(ctx, key, time.Now()))
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"helm-viewer/reference"
+)
+
+// registryURL returns the Distribution API base URL for a registry host
+func (s *HELMService) registryURL(registry string) string {
+	if registry == reference.DockerHubRegistry {
+		return s.registryBaseURL
+	}
+	if s.insecureRegistries[registry] {
+		return "http://" + registry
+	}
+	return "https://" + registry
+}
+
+// getManifest fetches a manifest by tag or digest from the image's registry
+func (s *HELMService) getManifest(ctx context.Context, ref reference.Reference, identifier string) (*manifest, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", s.registryURL(ref.Registry), ref.Path(), identifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating manifest request: %w", err)
+	}
+	req.Header.Set("Accept", manifestAcceptHeader)
+
+	resp, err := s.doRegistryRequest(req, ref.Registry, ref.Path())
+	if err != nil {
+		return nil, fmt.Errorf("error requesting registry %s: %w", ref.Registry, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{fmt.Sprintf("error getting manifest %s: %s", identifier, resp.Status), resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	m, err := parseManifest(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.digest = resp.Header.Get("Docker-Content-Digest")
+	if m.digest == "" {
+		sum := sha256.Sum256(body)
+		m.digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return m, nil
+}
+
+// resolveManifest fetches the image manifest, resolving image indexes to the
+// manifest of the configured platform, or of the first of the wanted
+// platforms the index has when it lacks the configured one
+func (s *HELMService) resolveManifest(ctx context.Context, ref reference.Reference, wanted []platform, all bool) (*manifest, error) {
+	m, err := s.getManifest(ctx, ref, ref.Identifier())
+	if err != nil {
+		return nil, err
+	}
+
+	if m.isIndex() {
+		d, err := m.selectPlatform(s.platform)
+		if err != nil {
+			var ok bool
+			if d, ok = m.selectWanted(wanted, all); !ok {
+				return nil, err
+			}
+		}
+		index := m
+		if m, err = s.getManifest(ctx, ref, d.Digest); err != nil {
+			return nil, err
+		}
+		if m.isIndex() {
+			return nil, fmt.Errorf("nested image index %s is not supported", d.Digest)
+		}
+		m.indexDigest = index.digest
+		m.platform = d.Platform
+	}
+
+	return m, nil
+}
+
+// openBlob starts downloading a blob by digest from the image's registry; the
+// caller must close the body
+func (s *HELMService) openBlob(ctx context.Context, ref reference.Reference, digest string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/%s", s.registryURL(ref.Registry), ref.Path(), digest)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating blob request: %w", err)
+	}
+
+	resp, err := s.doRegistryRequest(req, ref.Registry, ref.Path())
+	if err != nil {
+		return nil, fmt.Errorf("error requesting registry %s: %w", ref.Registry, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{fmt.Sprintf("error getting blob %s: %s", digest, resp.Status), resp.StatusCode}
+	}
+	return resp.Body, nil
+}
+
+// getBlob downloads a blob by digest from the image's registry and verifies
+// its content against the digest
+func (s *HELMService) getBlob(ctx context.Context, ref reference.Reference, digest string, maxSize int64) ([]byte, error) {
+	blob, err := s.openBlob(ctx, ref, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	body, err := io.ReadAll(io.LimitReader(blob, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob: %w", err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("blob %s exceeds %d bytes", digest, maxSize)
+	}
+
+	if err := verifyDigest(body, digest); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// verifyDigest checks content against a sha256 or sha512 digest
+func verifyDigest(content []byte, digest string) error {
+	verifier, err := newDigestVerifier(digest)
+	if err != nil {
+		return err
+	}
+	verifier.Write(content)
+	return verifier.verify()
+}
+
+// digestVerifier checks content written to it against a digest
+type digestVerifier struct {
+	hash.Hash
+	digest string
+}
+
+// newDigestVerifier creates a verifier for a sha256 or sha512 digest
+func newDigestVerifier(digest string) (*digestVerifier, error) {
+	algorithm, _, _ := strings.Cut(digest, ":")
+	switch algorithm {
+	case "sha256":
+		return &digestVerifier{Hash: sha256.New(), digest: digest}, nil
+	case "sha512":
+		return &digestVerifier{Hash: sha512.New(), digest: digest}, nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+}
+
+// verify reports whether the content written so far matches the digest
+func (v *digestVerifier) verify() error {
+	algorithm, expected, _ := strings.Cut(v.digest, ":")
+	actual := hex.EncodeToString(v.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("digest mismatch: expected %s, got %s:%s", v.digest, algorithm, actual)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryURL(t *testing.T) {
+	service := NewHELMService()
+	service.SetInsecureRegistries("localhost:5000")
+
+	require.Equal(t, "https://registry-1.docker.io", service.registryURL("docker.io"))
+	require.Equal(t, "https://ghcr.io", service.registryURL("ghcr.io"))
+	require.Equal(t, "http://localhost:5000", service.registryURL("localhost:5000"))
+}
@@ -0,0 +1,579 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"helm-viewer/models"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults used by `helm template` when no release information is given
+const (
+	defaultReleaseName = "release-name"
+	defaultNamespace   = "default"
+	defaultKubeVersion = "v1.29.0"
+	helmVersion        = "v3.14.0"
+)
+
+// Limits applied when rendering chart templates
+const (
+	maxIncludeDepth = 1000     // recursive include calls, as Helm does
+	maxRenderedSize = 50 << 20 // output of all templates, counting include and tpl output too
+	maxRangeLength  = 100000   // lists built by until and untilStep
+)
+
+// defaultAPIVersions are the API versions reported by .Capabilities.APIVersions
+var defaultAPIVersions = apiVersions{
+	"v1",
+	"admissionregistration.k8s.io/v1",
+	"apiextensions.k8s.io/v1",
+	"apps/v1",
+	"autoscaling/v1",
+	"autoscaling/v2",
+	"batch/v1",
+	"certificates.k8s.io/v1",
+	"coordination.k8s.io/v1",
+	"discovery.k8s.io/v1",
+	"events.k8s.io/v1",
+	"networking.k8s.io/v1",
+	"node.k8s.io/v1",
+	"policy/v1",
+	"rbac.authorization.k8s.io/v1",
+	"scheduling.k8s.io/v1",
+	"storage.k8s.io/v1",
+}
+
+// releaseInfo is exposed to templates as .Release
+type releaseInfo struct {
+	Name      string
+	Namespace string
+	Service   string
+	Revision  int
+	IsInstall bool
+	IsUpgrade bool
+}
+
+// kubeVersion is exposed to templates as .Capabilities.KubeVersion
+type kubeVersion struct {
+	Version    string
+	Major      string
+	Minor      string
+	GitVersion string
+}
+
+// String returns the Kubernetes version, e.g. "v1.29.0"
+func (v kubeVersion) String() string {
+	return v.Version
+}
+
+// apiVersions is exposed to templates as .Capabilities.APIVersions
+type apiVersions []string
+
+// Has reports whether an API version ("apps/v1") or resource ("apps/v1/Deployment") is available
+func (a apiVersions) Has(version string) bool {
+	for _, v := range a {
+		if v == version || strings.HasPrefix(version, v+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilities is exposed to templates as .Capabilities
+type capabilities struct {
+	KubeVersion kubeVersion
+	APIVersions apiVersions
+	HelmVersion struct{ Version string }
+}
+
+// newCapabilities returns the capabilities of a cluster with the given Kubernetes version
+func newCapabilities(version string) (capabilities, error) {
+	if version == "" {
+		version = defaultKubeVersion
+	}
+	parsed, err := semver.NewVersion(version)
+	if err != nil {
+		return capabilities{}, fmt.Errorf("invalid Kubernetes version %q: %w", version, err)
+	}
+
+	caps := capabilities{
+		KubeVersion: kubeVersion{
+			Version:    "v" + parsed.String(),
+			Major:      fmt.Sprint(parsed.Major()),
+			Minor:      fmt.Sprint(parsed.Minor()),
+			GitVersion: "v" + parsed.String(),
+		},
+		APIVersions: defaultAPIVersions,
+	}
+	caps.HelmVersion.Version = helmVersion
+	return caps, nil
+}
+
+// chartFiles is exposed to templates as .Files
+type chartFiles map[string][]byte
+
+// Get returns the content of a file as a string
+func (f chartFiles) Get(name string) string {
+	return string(f[name])
+}
+
+// GetBytes returns the content of a file
+func (f chartFiles) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Glob returns the files matching a pattern
+func (f chartFiles) Glob(pattern string) chartFiles {
+	matched := chartFiles{}
+	for name, content := range f {
+		if ok, _ := path.Match(pattern, name); ok {
+			matched[name] = content
+		}
+	}
+	return matched
+}
+
+// Lines returns the lines of a file
+func (f chartFiles) Lines(name string) []string {
+	content := strings.TrimSuffix(string(f[name]), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// AsConfig returns the files as ConfigMap data
+func (f chartFiles) AsConfig() string {
+	data := map[string]string{}
+	for name, content := range f {
+		data[path.Base(name)] = string(content)
+	}
+	return toYAML(data)
+}
+
+// AsSecrets returns the files as base64 encoded Secret data
+func (f chartFiles) AsSecrets() string {
+	data := map[string]string{}
+	for name, content := range f {
+		data[path.Base(name)] = base64.StdEncoding.EncodeToString(content)
+	}
+	return toYAML(data)
+}
+
+// renderTarget is a chart to render together with its coalesced values
+type renderTarget struct {
+	chart        *chart
+	name         string // template path prefix, e.g. "mychart/charts/redis"
+	valuesPrefix string // path of the values in the top-level chart, e.g. "redis"
+	values       map[string]any
+	subchartKeys []string // keys of values that belong to subcharts
+}
+
+// renderEngine executes chart templates with Helm template engine semantics.
+// Rendering stops once ctx is done, as checked on every write and every
+// until, untilStep, include and tpl call, or once the output exceeds
+// maxRenderedSize.
+type renderEngine struct {
+	ctx          context.Context
+	template     *template.Template
+	includeDepth map[string]int
+	remaining    int64
+
+	// tplTemplate is the clone of the chart templates tpl parses its text
+	// into, made on the first tpl call; tplDepth is the nesting of tpl calls
+	tplTemplate *template.Template
+	tplDepth    int
+}
+
+// renderWriter writes template output to a buffer within the output budget
+// of its engine, failing once the engine's context is done
+type renderWriter struct {
+	engine *renderEngine
+	buf    *bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *renderWriter) Write(p []byte) (int, error) {
+	if err := w.engine.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if int64(len(p)) > w.engine.remaining {
+		return 0, fmt.Errorf("rendered output exceeds %d bytes", maxRenderedSize)
+	}
+	w.engine.remaining -= int64(len(p))
+	return w.buf.Write(p)
+}
+
+// execute executes a template into a buffer within the output budget
+func (e *renderEngine) execute(t *template.Template, name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&renderWriter{engine: e, buf: &buf}, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderChart renders the templates of a chart and its enabled subcharts,
+// collected by collectRenderTargets, and returns the rendered manifests as documents
+func renderChart(ctx context.Context, targets []renderTarget, opts models.LoadOptions) ([]models.YAMLDocument, error) {
+	caps, err := newCapabilities(opts.KubeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	release := releaseInfo{
+		Name:      opts.ReleaseName,
+		Namespace: opts.Namespace,
+		Service:   "Helm",
+		Revision:  1,
+		IsInstall: true,
+	}
+	if release.Name == "" {
+		release.Name = defaultReleaseName
+	}
+	if release.Namespace == "" {
+		release.Namespace = defaultNamespace
+	}
+
+	engine := &renderEngine{ctx: ctx, includeDepth: map[string]int{}, remaining: maxRenderedSize}
+	engine.template = template.New("gotpl").Option("missingkey=zero").Funcs(engine.funcMap())
+
+	// All templates share one set so charts can include their subcharts' helpers
+	for _, target := range targets {
+		for _, name := range target.chart.sortedFileNames() {
+			if !strings.HasPrefix(name, "templates/") {
+				continue
+			}
+			if _, err := engine.template.New(path.Join(target.name, name)).Parse(string(target.chart.files[name])); err != nil {
+				return nil, fmt.Errorf("failed to parse template %s: %w", target.chart.sourcePath(name), err)
+			}
+		}
+	}
+
+	var docs []models.YAMLDocument
+	for _, target := range targets {
+		files := chartFiles{}
+		for name, content := range target.chart.files {
+			if !strings.HasPrefix(name, "templates/") {
+				files[name] = content
+			}
+		}
+
+		for _, name := range target.chart.sortedFileNames() {
+			if !isRenderedTemplate(name) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			templateName := path.Join(target.name, name)
+			data := map[string]any{
+				"Values":       target.values,
+				"Chart":        target.chart.metadata,
+				"Release":      release,
+				"Capabilities": caps,
+				"Files":        files,
+				"Template": map[string]any{
+					"Name":     templateName,
+					"BasePath": path.Join(target.name, "templates"),
+				},
+			}
+
+			output, err := engine.execute(engine.template, templateName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render template %s: %w", target.chart.sourcePath(name), err)
+			}
+
+			rendered, err := parseYAMLDocuments([]byte(strings.ReplaceAll(output, "<no value>", "")))
+			if err != nil {
+				return nil, fmt.Errorf("invalid manifest rendered from %s: %w", target.chart.sourcePath(name), err)
+			}
+			for _, doc := range rendered {
+				doc.Source = target.chart.sourcePath(name)
+				doc.Chart = target.chart.metadata.Name
+				docs = append(docs, doc)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// isRenderedTemplate reports whether a template produces manifests; partials
+// starting with "_" and NOTES.txt only provide helpers and messages
+func isRenderedTemplate(name string) bool {
+	if !strings.HasPrefix(name, "templates/") {
+		return false
+	}
+	base := path.Base(name)
+	return !strings.HasPrefix(base, "_") && base != "NOTES.txt"
+}
+
+// collectRenderTargets coalesces the values of a chart and its subcharts the
+// way Helm does: subcharts get their section of the parent values merged over
+// their defaults plus the parent's globals, and subcharts disabled by a
+// dependency condition or tags are skipped
+func collectRenderTargets(c *chart, name, valuesPrefix string, values map[string]any) ([]renderTarget, error) {
+	targets := []renderTarget{{chart: c, name: name, valuesPrefix: valuesPrefix, values: values}}
+
+	globals, _ := values["global"].(map[string]any)
+	for _, sub := range c.subcharts {
+		dep := findDependency(c.metadata, sub.metadata.Name)
+		key := sub.metadata.Name
+		if dep.Alias != "" {
+			key = dep.Alias
+		}
+		targets[0].subchartKeys = append(targets[0].subchartKeys, key)
+		if !dependencyEnabled(dep, values) {
+			continue
+		}
+
+		defaults, err := chartValues(sub)
+		if err != nil {
+			return nil, err
+		}
+		overrides, _ := values[key].(map[string]any)
+		subValues := coalesceValues(deepCopyMap(overrides), defaults)
+
+		subGlobals, _ := subValues["global"].(map[string]any)
+		subValues["global"] = coalesceValues(deepCopyMap(globals), subGlobals)
+
+		// The parent sees the subchart values including their defaults
+		values[key] = subValues
+
+		subPrefix := key
+		if valuesPrefix != "" {
+			subPrefix = valuesPrefix + "." + key
+		}
+		subTargets, err := collectRenderTargets(sub, path.Join(name, "charts", key), subPrefix, subValues)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, subTargets...)
+	}
+
+	return targets, nil
+}
+
+// findDependency returns the Chart.yaml dependency of a subchart, matching by
+// name; subcharts not declared as dependencies get an empty one
+func findDependency(metadata chartMetadata, name string) chartDependency {
+	for _, dep := range metadata.Dependencies {
+		if dep.Name == name {
+			return dep
+		}
+	}
+	return chartDependency{Name: name}
+}
+
+// dependencyEnabled evaluates the condition and tags of a dependency against
+// the parent values. The first condition path holding a boolean decides;
+// otherwise the dependency is enabled unless all of its tags are false.
+func dependencyEnabled(dep chartDependency, values map[string]any) bool {
+	for _, condition := range strings.Split(dep.Condition, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+		if enabled, ok := lookupPath(values, condition).(bool); ok {
+			return enabled
+		}
+	}
+
+	if len(dep.Tags) == 0 {
+		return true
+	}
+	tags, _ := values["tags"].(map[string]any)
+	anySet := false
+	for _, tag := range dep.Tags {
+		if enabled, ok := tags[tag].(bool); ok {
+			if enabled {
+				return true
+			}
+			anySet = true
+		}
+	}
+	return !anySet
+}
+
+// funcMap returns the template functions: sprig without environment and
+// network access and with bounded list and string builders, plus the
+// Helm-specific functions
+func (e *renderEngine) funcMap() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	delete(funcs, "getHostByName")
+
+	until := funcs["until"].(func(int) []int)
+	untilStep := funcs["untilStep"].(func(int, int, int) []int)
+
+	extra := template.FuncMap{
+		"toYaml":        toYAML,
+		"fromYaml":      fromYAML,
+		"fromYamlArray": fromYAMLArray,
+		"toJson":        toJSON,
+		"fromJson":      fromJSON,
+		"fromJsonArray": fromJSONArray,
+		"include":       e.include,
+		"tpl":           e.tpl,
+		"until": func(count int) ([]int, error) {
+			if err := e.ctx.Err(); err != nil {
+				return nil, err
+			}
+			if count > maxRangeLength {
+				return nil, fmt.Errorf("until %d exceeds %d elements", count, maxRangeLength)
+			}
+			return until(count), nil
+		},
+		"untilStep": func(start, stop, step int) ([]int, error) {
+			if err := e.ctx.Err(); err != nil {
+				return nil, err
+			}
+			if step != 0 && (stop-start)/step > maxRangeLength {
+				return nil, fmt.Errorf("untilStep %d %d %d exceeds %d elements", start, stop, step, maxRangeLength)
+			}
+			return untilStep(start, stop, step), nil
+		},
+		"repeat": func(count int, str string) (string, error) {
+			if count > 0 && int64(len(str)) > maxRenderedSize/int64(count) {
+				return "", fmt.Errorf("repeat exceeds %d bytes", maxRenderedSize)
+			}
+			return strings.Repeat(str, count), nil
+		},
+		"required": func(message string, value any) (any, error) {
+			if value == nil || value == "" {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"fail": func(message string) (string, error) {
+			return "", errors.New(message)
+		},
+		// There is no cluster to look resources up in
+		"lookup": func(apiVersion, kind, namespace, name string) (map[string]any, error) {
+			return map[string]any{}, nil
+		},
+	}
+	for name, fn := range extra {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// include executes a named template and returns its output
+func (e *renderEngine) include(name string, data any) (string, error) {
+	if err := e.ctx.Err(); err != nil {
+		return "", err
+	}
+	if e.includeDepth[name] >= maxIncludeDepth {
+		return "", fmt.Errorf("rendering template has a nested reference name: %s", name)
+	}
+	e.includeDepth[name]++
+	defer func() { e.includeDepth[name]-- }()
+
+	output, err := e.execute(e.template, name, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(output, "<no value>", ""), nil
+}
+
+// tpl renders a string as a template with access to all chart templates.
+// Texts are parsed into one clone of the chart templates per render, named
+// after their nesting so that nested tpl calls do not replace each other.
+func (e *renderEngine) tpl(text string, data any) (string, error) {
+	if err := e.ctx.Err(); err != nil {
+		return "", err
+	}
+	if e.tplTemplate == nil {
+		t, err := e.template.Clone()
+		if err != nil {
+			return "", fmt.Errorf("cannot clone template: %w", err)
+		}
+		e.tplTemplate = t
+	}
+
+	name := fmt.Sprintf("tpl-%d", e.tplDepth)
+	e.tplDepth++
+	defer func() { e.tplDepth-- }()
+
+	if _, err := e.tplTemplate.New(name).Parse(text); err != nil {
+		return "", fmt.Errorf("cannot parse template %q: %w", text, err)
+	}
+
+	output, err := e.execute(e.tplTemplate, name, data)
+	if err != nil {
+		return "", fmt.Errorf("error during tpl function execution for %q: %w", text, err)
+	}
+	return strings.ReplaceAll(output, "<no value>", ""), nil
+}
+
+// toYAML marshals a value to YAML with a two-space indent; errors yield an empty string
+func toYAML(v any) string {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return ""
+	}
+	encoder.Close()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// fromYAML unmarshals a YAML map; errors are reported under the "Error" key
+func fromYAML(s string) map[string]any {
+	m := map[string]any{}
+	if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+// fromYAMLArray unmarshals a YAML list; errors are reported as the only element
+func fromYAMLArray(s string) []any {
+	var a []any
+	if err := yaml.Unmarshal([]byte(s), &a); err != nil {
+		return []any{err.Error()}
+	}
+	return a
+}
+
+// toJSON marshals a value to JSON; errors yield an empty string
+func toJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fromJSON unmarshals a JSON object; errors are reported under the "Error" key
+func fromJSON(s string) map[string]any {
+	m := map[string]any{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+// fromJSONArray unmarshals a JSON list; errors are reported as the only element
+func fromJSONArray(s string) []any {
+	var a []any
+	if err := json.Unmarshal([]byte(s), &a); err != nil {
+		return []any{err.Error()}
+	}
+	return a
+}
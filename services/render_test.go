@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// renderTestChart is a chart whose images are only complete after rendering
+func renderTestChart(t *testing.T) []byte {
+	t.Helper()
+
+	redis := buildChartArchive(t, map[string]string{
+		"redis/Chart.yaml":  "name: redis\nversion: 1.0.0\n",
+		"redis/values.yaml": "image:\n  repository: redis\n  tag: \"7.2\"\n",
+		"redis/templates/statefulset.yaml": `
+apiVersion: apps/v1
+kind: StatefulSet
+spec:
+  template:
+    spec:
+      containers:
+        - name: redis
+          image: "{{ .Values.global.registry }}/{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`,
+	})
+	metrics := buildChartArchive(t, map[string]string{
+		"metrics/Chart.yaml": "name: metrics\nversion: 1.0.0\n",
+		"metrics/templates/deployment.yaml": `
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: exporter
+          image: prom/exporter:1.0
+`,
+	})
+
+	return buildChartArchive(t, map[string]string{
+		"mychart/Chart.yaml": `
+apiVersion: v2
+name: mychart
+version: 1.2.3
+appVersion: "2.0.1"
+dependencies:
+  - name: redis
+    condition: redis.enabled
+  - name: metrics
+    condition: metrics.enabled
+`,
+		"mychart/values.yaml": `
+global:
+  registry: registry.example.com
+image:
+  name: app
+sidecar:
+  image: "{{ .Values.global.registry }}/sidecar:{{ .Chart.Version }}"
+redis:
+  enabled: true
+metrics:
+  enabled: false
+`,
+		"mychart/templates/_helpers.tpl": `
+{{- define "mychart.image" -}}
+{{ .Values.global.registry }}/{{ .Values.image.name }}:{{ .Chart.AppVersion }}
+{{- end -}}
+`,
+		"mychart/templates/deployment.yaml": `
+{{- if .Capabilities.APIVersions.Has "apps/v1" }}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name | trunc 63 }}
+  namespace: {{ .Release.Namespace }}
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: {{ include "mychart.image" . | quote }}
+        - name: sidecar
+          image: {{ tpl .Values.sidecar.image . }}
+{{- end }}
+---
+# empty document
+`,
+		"mychart/templates/NOTES.txt":      "{{ fail \"not rendered\" }}",
+		"mychart/charts/redis-1.0.0.tgz":   string(redis),
+		"mychart/charts/metrics-1.0.0.tgz": string(metrics),
+	})
+}
+
+func TestLoadChartArchive_Render(t *testing.T) {
+	docs, err := loadChartArchive(context.Background(), renderTestChart(t), nil, models.LoadOptions{Render: true, ReleaseName: "prod", Namespace: "apps"})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	service := NewHELMService()
+	found := map[string]string{}
+	workloads := map[string]string{}
+	for _, doc := range docs {
+		for _, image := range service.FindDocumentImages(doc) {
+			found[image.Name] = image.Source
+			workloads[image.Name] = image.Workload
+		}
+	}
+	require.Equal(t, "Deployment/prod", workloads["registry.example.com/app:2.0.1"])
+	require.Empty(t, workloads["registry.example.com/redis:7.2"])
+	require.Equal(t, map[string]string{
+		"registry.example.com/app:2.0.1":     "mychart/templates/deployment.yaml",
+		"registry.example.com/sidecar:1.2.3": "mychart/templates/deployment.yaml",
+		"registry.example.com/redis:7.2":     "mychart/charts/redis-1.0.0.tgz/redis/templates/statefulset.yaml",
+	}, found)
+
+	metadata := docs[0].Content.(map[string]any)["metadata"].(map[string]any)
+	require.Equal(t, "prod", metadata["name"])
+	require.Equal(t, "apps", metadata["namespace"])
+}
+
+func TestLoadChartArchive_RenderNestedTpl(t *testing.T) {
+	archive := buildChartArchive(t, map[string]string{
+		"mychart/Chart.yaml":       "name: mychart\n",
+		"mychart/values.yaml":      "tag: \"1\"\ninner: \"{{ .Values.tag }}\"\nouter: \"{{ tpl .Values.inner . }}-{{ .Values.tag }}\"\n",
+		"mychart/templates/a.yaml": `image: app:{{ tpl .Values.outer . }}`,
+		"mychart/templates/b.yaml": `image: app:{{ tpl .Values.inner . }}`,
+	})
+	docs, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "app:1-1", docs[0].Content.(map[string]any)["image"])
+	require.Equal(t, "app:1", docs[1].Content.(map[string]any)["image"])
+}
+
+func TestLoadChartArchive_RenderErrors(t *testing.T) {
+	t.Run("required value", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `image: {{ required "image is required" .Values.image }}`,
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.ErrorContains(t, err, "image is required")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": "image: {{ .Values.image",
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.ErrorContains(t, err, "failed to parse template mychart/templates/config.yaml")
+	})
+
+	t.Run("environment is not exposed", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `home: {{ env "HOME" }}`,
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.Error(t, err)
+	})
+
+	t.Run("network is not exposed", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `host: {{ getHostByName "example.com" }}`,
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.ErrorContains(t, err, "getHostByName")
+	})
+
+	t.Run("unbounded range", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `{{ range until 2000000000 }}x{{ end }}`,
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.ErrorContains(t, err, "exceeds")
+	})
+
+	t.Run("output limit", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `{{ range until 100000 }}{{ repeat 1000 "x" }}{{ end }}`,
+		})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true})
+		require.ErrorContains(t, err, "rendered output exceeds")
+	})
+
+	t.Run("output-less loop past the deadline", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{
+			"mychart/Chart.yaml":            "name: mychart\n",
+			"mychart/templates/config.yaml": `{{ range until 100000 }}{{ range until 100000 }}{{ end }}{{ end }}`,
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := loadChartArchive(ctx, archive, nil, models.LoadOptions{Render: true})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := loadChartArchive(ctx, renderTestChart(t), nil, models.LoadOptions{Render: true})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("invalid kube version", func(t *testing.T) {
+		archive := buildChartArchive(t, map[string]string{"mychart/Chart.yaml": "name: mychart\n"})
+		_, err := loadChartArchive(context.Background(), archive, nil, models.LoadOptions{Render: true, KubeVersion: "latest"})
+		require.ErrorContains(t, err, "invalid Kubernetes version")
+	})
+}
+
+func TestLoadAndParseYAML_RenderRequiresChart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image: nginx\n"))
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	_, err := service.LoadAndParseYAML(context.Background(), server.URL+"/values.yaml", models.LoadOptions{Render: true})
+	require.ErrorContains(t, err, "only charts can be rendered")
+}
+
+func TestDependencyEnabled(t *testing.T) {
+	values := map[string]any{
+		"redis": map[string]any{"enabled": false},
+		"cache": map[string]any{"enabled": true},
+		"tags":  map[string]any{"backend": false, "frontend": true},
+	}
+
+	tests := []struct {
+		name string
+		dep  chartDependency
+		want bool
+	}{
+		{"no condition", chartDependency{Name: "a"}, true},
+		{"condition false", chartDependency{Condition: "redis.enabled"}, false},
+		{"first set condition wins", chartDependency{Condition: "missing.enabled,cache.enabled,redis.enabled"}, true},
+		{"all tags false", chartDependency{Tags: []string{"backend"}}, false},
+		{"any tag true", chartDependency{Tags: []string{"backend", "frontend"}}, true},
+		{"condition over tags", chartDependency{Condition: "cache.enabled", Tags: []string{"backend"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, dependencyEnabled(tt.dep, values))
+		})
+	}
+}
+
+func TestCoalesceValues(t *testing.T) {
+	values := coalesceValues(
+		map[string]any{"image": map[string]any{"tag": "2.0"}, "resources": nil},
+		map[string]any{"image": map[string]any{"repository": "nginx", "tag": "1.0"}, "resources": map[string]any{"cpu": 1}},
+	)
+	require.Equal(t, map[string]any{"image": map[string]any{"repository": "nginx", "tag": "2.0"}}, values)
+}
+
+func TestChartFiles(t *testing.T) {
+	files := chartFiles{
+		"config/a.conf": []byte("a=1\nb=2\n"),
+		"config/b.conf": []byte("c=3"),
+		"README.md":     []byte("readme"),
+	}
+
+	require.Equal(t, []string{"a=1", "b=2"}, files.Lines("config/a.conf"))
+
+	matched := files.Glob("config/*")
+	names := make([]string, 0, len(matched))
+	for name := range matched {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{"config/a.conf", "config/b.conf"}, names)
+	require.Equal(t, "a.conf: |\n  a=1\n  b=2\nb.conf: c=3", matched.AsConfig())
+}
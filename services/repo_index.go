@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"helm-viewer/models"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// repoIndex is the index.yaml of a Helm chart repository
+type repoIndex struct {
+	APIVersion string                        `yaml:"apiVersion"`
+	Entries    map[string][]repoChartVersion `yaml:"entries"`
+}
+
+// repoChartVersion is a single chart version entry of a repository index
+type repoChartVersion struct {
+	Name        string    `yaml:"name"`
+	Version     string    `yaml:"version"`
+	AppVersion  string    `yaml:"appVersion"`
+	Description string    `yaml:"description"`
+	URLs        []string  `yaml:"urls"`
+	Digest      string    `yaml:"digest"`
+	Created     time.Time `yaml:"created"`
+	Deprecated  bool      `yaml:"deprecated"`
+
+	semver *semver.Version
+}
+
+// fetchRepoIndex downloads and parses index.yaml of a chart repository.
+// Versions that are not valid semantic versions are skipped, and the
+// versions of every chart are sorted newest first.
+func (s *HELMService) fetchRepoIndex(ctx context.Context, repoURL string) (*repoIndex, error) {
+	indexURL := strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+
+	resp, err := s.httpGet(ctx, indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repository index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch repository index: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository index: %w", err)
+	}
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("repository index exceeds %d bytes", maxDownloadSize)
+	}
+
+	var index repoIndex
+	if err := yaml.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("invalid repository index: %w", err)
+	}
+	if len(index.Entries) == 0 {
+		return nil, fmt.Errorf("repository index at %s has no charts", indexURL)
+	}
+
+	for name, versions := range index.Entries {
+		valid := versions[:0]
+		for _, v := range versions {
+			parsed, err := semver.NewVersion(v.Version)
+			if err != nil {
+				continue
+			}
+			v.semver = parsed
+			valid = append(valid, v)
+		}
+		sort.SliceStable(valid, func(i, j int) bool {
+			return valid[i].semver.GreaterThan(valid[j].semver)
+		})
+		index.Entries[name] = valid
+	}
+
+	return &index, nil
+}
+
+// ListRepoCharts lists the charts and versions of a Helm chart repository
+func (s *HELMService) ListRepoCharts(ctx context.Context, repoURL string) ([]models.RepoChart, error) {
+	index, err := s.fetchRepoIndex(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	charts := make([]models.RepoChart, 0, len(index.Entries))
+	for name, versions := range index.Entries {
+		if len(versions) == 0 {
+			continue
+		}
+
+		// Describe the chart by its latest stable version when there is one
+		latest, err := selectChartVersion(versions, "")
+		if err != nil {
+			latest = versions[0]
+		}
+		chart := models.RepoChart{
+			Name:          name,
+			Description:   latest.Description,
+			LatestVersion: latest.Version,
+		}
+		for _, v := range versions {
+			chart.Versions = append(chart.Versions, models.RepoChartVersion{
+				Version:    v.Version,
+				AppVersion: v.AppVersion,
+				Created:    v.Created,
+				Deprecated: v.Deprecated,
+			})
+		}
+		charts = append(charts, chart)
+	}
+
+	sort.Slice(charts, func(i, j int) bool {
+		return charts[i].Name < charts[j].Name
+	})
+	return charts, nil
+}
+
+// ResolveChartURL returns the archive URL of a chart version in a Helm chart
+// repository. The version may be an exact version or a constraint such as
+// "^1.2"; when empty, the latest stable version is used.
+func (s *HELMService) ResolveChartURL(ctx context.Context, repoURL, name, version string) (string, error) {
+	index, err := s.fetchRepoIndex(ctx, repoURL)
+	if err != nil {
+		return "", err
+	}
+
+	versions, ok := index.Entries[name]
+	if !ok || len(versions) == 0 {
+		return "", fmt.Errorf("chart %s not found in repository %s", name, repoURL)
+	}
+
+	selected, err := selectChartVersion(versions, version)
+	if err != nil {
+		return "", fmt.Errorf("chart %s: %w", name, err)
+	}
+	if len(selected.URLs) == 0 {
+		return "", fmt.Errorf("chart %s %s has no download URL", name, selected.Version)
+	}
+
+	return resolveChartDownloadURL(repoURL, selected.URLs[0])
+}
+
+// selectChartVersion picks the newest version matching a version constraint
+// from versions sorted newest first. An empty constraint selects the newest
+// stable version, like Helm does without --devel.
+func selectChartVersion(versions []repoChartVersion, version string) (repoChartVersion, error) {
+	if version == "" {
+		for _, v := range versions {
+			if v.semver.Prerelease() == "" {
+				return v, nil
+			}
+		}
+		return repoChartVersion{}, fmt.Errorf("no stable version found")
+	}
+
+	// Exact versions match as written, including prereleases and build metadata
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return repoChartVersion{}, fmt.Errorf("invalid version %q: %w", version, err)
+	}
+	for _, v := range versions {
+		if constraint.Check(v.semver) {
+			return v, nil
+		}
+	}
+	return repoChartVersion{}, fmt.Errorf("no version matching %q found", version)
+}
+
+// resolveChartDownloadURL resolves a chart URL from the index, which may be
+// relative to the repository URL
+func resolveChartDownloadURL(repoURL, chartURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(repoURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL %q: %w", repoURL, err)
+	}
+	ref, err := url.Parse(chartURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart URL %q: %w", chartURL, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
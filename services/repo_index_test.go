@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRepoIndex = `
+apiVersion: v1
+entries:
+  nginx:
+    - name: nginx
+      version: 1.10.0
+      appVersion: "1.25"
+      description: NGINX web server
+      urls: [charts/nginx-1.10.0.tgz]
+      created: "2024-02-01T00:00:00Z"
+    - name: nginx
+      version: 2.0.0-rc.1
+      urls: [charts/nginx-2.0.0-rc.1.tgz]
+    - name: nginx
+      version: 1.9.2
+      urls: [https://cdn.example.com/nginx-1.9.2.tgz]
+      deprecated: true
+    - name: nginx
+      version: not-semver
+      urls: [charts/broken.tgz]
+  redis:
+    - name: redis
+      version: 0.1.0
+      urls: []
+`
+
+func newFakeRepo(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stable/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testRepoIndex))
+	}))
+}
+
+func TestListRepoCharts(t *testing.T) {
+	repo := newFakeRepo(t)
+	defer repo.Close()
+
+	service := NewHELMService()
+	charts, err := service.ListRepoCharts(context.Background(), repo.URL+"/stable/")
+	require.NoError(t, err)
+	require.Len(t, charts, 2)
+
+	require.Equal(t, "nginx", charts[0].Name)
+	require.Equal(t, "NGINX web server", charts[0].Description)
+	require.Equal(t, "1.10.0", charts[0].LatestVersion)
+	require.Len(t, charts[0].Versions, 3)
+	require.Equal(t, "2.0.0-rc.1", charts[0].Versions[0].Version)
+	require.Equal(t, "1.25", charts[0].Versions[1].AppVersion)
+	require.Equal(t, 2024, charts[0].Versions[1].Created.Year())
+	require.True(t, charts[0].Versions[2].Deprecated)
+
+	require.Equal(t, "redis", charts[1].Name)
+
+	_, err = service.ListRepoCharts(context.Background(), repo.URL+"/missing")
+	require.Error(t, err)
+}
+
+func TestResolveChartURL(t *testing.T) {
+	repo := newFakeRepo(t)
+	defer repo.Close()
+
+	service := NewHELMService()
+	testCases := []struct {
+		version  string
+		expected string
+	}{
+		{"", repo.URL + "/stable/charts/nginx-1.10.0.tgz"},
+		{"2.0.0-rc.1", repo.URL + "/stable/charts/nginx-2.0.0-rc.1.tgz"},
+		{"~1.9", "https://cdn.example.com/nginx-1.9.2.tgz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			url, err := service.ResolveChartURL(context.Background(), repo.URL+"/stable", "nginx", tc.version)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, url)
+		})
+	}
+
+	t.Run("unknown chart", func(t *testing.T) {
+		_, err := service.ResolveChartURL(context.Background(), repo.URL+"/stable", "postgres", "")
+		require.Error(t, err)
+	})
+
+	t.Run("no matching version", func(t *testing.T) {
+		_, err := service.ResolveChartURL(context.Background(), repo.URL+"/stable", "nginx", ">=3.0.0")
+		require.Error(t, err)
+	})
+
+	t.Run("no download URL", func(t *testing.T) {
+		_, err := service.ResolveChartURL(context.Background(), repo.URL+"/stable", "redis", "")
+		require.Error(t, err)
+	})
+}
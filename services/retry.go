@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy tells how often and how long to wait before retrying
+// registry requests
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// SetRetryPolicy sets the number of attempts of registry requests and the
+// bounds of the exponential backoff between them
+func (s *HELMService) SetRetryPolicy(attempts int, baseDelay, maxDelay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	s.retry = retryPolicy{attempts: attempts, baseDelay: baseDelay, maxDelay: maxDelay}
+}
+
+// sendRegistryRequest sends a request to a registry through its rate
+// limiters and circuit breaker, retrying connection errors, 5xx and 429
+// responses with jittered exponential backoff, or after the delay of a
+// Retry-After header. The request counts against the quota of key, the
+// credential it is sent with. The response of the last attempt is returned.
+func (s *HELMService) sendRegistryRequest(req *http.Request, key quotaKey) (*http.Response, error) {
+	registry := key.registry
+	for attempt := 1; ; attempt++ {
+		if err := s.rateLimits.wait(req.Context(), key, s.now()); err != nil {
+			return nil, err
+		}
+		if err := s.breakers.allow(registry, s.now()); err != nil {
+			return nil, err
+		}
+
+		attemptReq, err := retryableRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.httpClient.Do(attemptReq)
+		if req.Context().Err() != nil {
+			// Canceled requests say nothing about the registry
+			s.breakers.abandon(registry)
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+
+		if err == nil {
+			s.rateLimits.update(key, resp, s.now())
+		}
+
+		transient := err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		s.breakers.record(registry, err == nil && resp.StatusCode < http.StatusInternalServerError, s.now())
+		if !transient || attempt >= s.retry.attempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := s.retry.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), s.now()); ok {
+				if after > s.retry.maxDelay {
+					return resp, nil
+				}
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		s.breakers.retried(registry)
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryableRequest returns the request to send for an attempt, with a fresh
+// body for retries
+func retryableRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+// backoff returns a random delay of up to baseDelay doubled for every
+// attempt made, capped at maxDelay ("full jitter")
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.maxDelay
+	if shift := attempt - 1; shift < 30 && p.baseDelay<<shift < p.maxDelay {
+		delay = p.baseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
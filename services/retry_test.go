@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetImageInfo_Retries(t *testing.T) {
+	manifest := `{"schemaVersion": 2, "mediaType": "` + mediaTypeOCIManifest + `", "layers": [{"digest": "sha256:a", "size": 1024}]}`
+
+	var requests int32
+	failures := map[string]int{"/v2/library/flaky/manifests/1.0": 2, "/v2/library/limited/manifests/1.0": 1}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		switch r.URL.Path {
+		case "/v2/library/flaky/manifests/1.0":
+			if n <= failures[r.URL.Path] {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/v2/library/limited/manifests/1.0":
+			if n <= failures[r.URL.Path] {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		case "/v2/library/throttled/manifests/1.0":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "/v2/library/down/manifests/1.0":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write([]byte(manifest))
+	}))
+	defer registry.Close()
+
+	newService := func() *HELMService {
+		atomic.StoreInt32(&requests, 0)
+		service := NewHELMService()
+		service.SetRegistryBaseURL(registry.URL)
+		service.SetRetryPolicy(3, time.Millisecond, 10*time.Millisecond)
+		return service
+	}
+
+	t.Run("transient 5xx", func(t *testing.T) {
+		service := newService()
+		size, _, err := service.GetImageInfo(context.Background(), "flaky:1.0")
+		require.NoError(t, err)
+		require.Equal(t, "1.00 KB", size)
+		require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+		stats := service.RegistryStats("docker.io")
+		require.Len(t, stats, 1)
+		require.Equal(t, int64(3), stats[0].Requests)
+		require.Equal(t, int64(2), stats[0].Retries)
+		require.Equal(t, "closed", stats[0].Circuit)
+	})
+
+	t.Run("429 with Retry-After", func(t *testing.T) {
+		service := newService()
+		_, _, err := service.GetImageInfo(context.Background(), "limited:1.0")
+		require.NoError(t, err)
+		require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("Retry-After beyond the maximum delay", func(t *testing.T) {
+		service := newService()
+		_, _, err := service.GetImageInfo(context.Background(), "throttled:1.0")
+		var imageErr *models.ImageError
+		require.ErrorAs(t, err, &imageErr)
+		require.Equal(t, models.ImageErrorRateLimited, imageErr.Code)
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		service := newService()
+		_, _, err := service.GetImageInfo(context.Background(), "down:1.0")
+		require.Error(t, err)
+		require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{attempts: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 40: time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(attempt)
+			require.GreaterOrEqual(t, delay, time.Duration(0))
+			require.LessOrEqual(t, delay, limit)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := retryAfter("7", now)
+	require.True(t, ok)
+	require.Equal(t, 7*time.Second, delay)
+
+	delay, ok = retryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, delay)
+
+	_, ok = retryAfter("", now)
+	require.False(t, ok)
+	_, ok = retryAfter("soon", now)
+	require.False(t, ok)
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm-viewer/config"
+	"helm-viewer/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetExtractionRules sets the rules used to find images the built-in
+// discovery misses; rules with a regex must be compiled with Compile
+func (s *HELMService) SetExtractionRules(rules []config.ExtractionRule) {
+	s.extractionRules = rules
+}
+
+// FindDocumentImages finds the container images of a document with the
+// built-in discovery and the extraction rules that apply to its chart;
+// documents of plain YAML URLs have no chart, so only rules without one
+// apply to them. The containers of workload manifests are found through their pod spec, with
+// their role and pull policy. Source, workload and resource are recorded on
+// each image.
+func (s *HELMService) FindDocumentImages(doc models.YAMLDocument) []models.ContainerImage {
+	root := contentNode(doc.Content)
+	discovered := mergeDiscoveredImages(discoverWorkloadImages(root), discoverImages(root))
+
+	seen := map[string]bool{}
+	for _, d := range discovered {
+		seen[d.image.Name] = true
+	}
+	for _, rule := range s.extractionRules {
+		if !ruleAppliesTo(rule, doc) {
+			continue
+		}
+		for _, d := range applyExtractionRule(rule, doc.Content) {
+			if !seen[d.image.Name] {
+				seen[d.image.Name] = true
+				discovered = append(discovered, d)
+			}
+		}
+	}
+
+	images := finalizeImages(discovered, doc)
+	workload, resource := manifestWorkload(root), manifestResource(root)
+	for i := range images {
+		images[i].Source = doc.Source
+		images[i].Workload = workload
+		images[i].Resource = resource
+	}
+	return images
+}
+
+// ruleAppliesTo reports whether a rule applies to a document: rules without a
+// chart apply to every document, chart-scoped ones only to documents of that
+// chart, never to the chartless documents of plain YAML URLs
+func ruleAppliesTo(rule config.ExtractionRule, doc models.YAMLDocument) bool {
+	return rule.Chart == "" || (doc.Chart != "" && rule.Chart == doc.Chart)
+}
+
+// selectedValue is a value selected by a rule path
+type selectedValue struct {
+	value any
+	path  []string
+}
+
+// applyExtractionRule returns the images found at the path of a rule
+func applyExtractionRule(rule config.ExtractionRule, content any) []discoveredImage {
+	if node, ok := content.(*yaml.Node); ok {
+		if err := node.Decode(&content); err != nil {
+			return nil
+		}
+	}
+
+	var images []discoveredImage
+	for _, selected := range selectPath(content, selectedValue{}, rulePathSegments(rule.Path)) {
+		images = append(images, ruleImages(rule, selected)...)
+	}
+	return images
+}
+
+// rulePathSegments splits a rule path such as "$.spec.containers[*].args"
+// into keys and list selectors: "spec", "containers", "[*]", "args"
+func rulePathSegments(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		key, selectors, _ := strings.Cut(part, "[")
+		if key != "" {
+			segments = append(segments, key)
+		}
+		if selectors != "" {
+			for _, selector := range strings.Split(strings.TrimSuffix(selectors, "]"), "][") {
+				segments = append(segments, "["+selector+"]")
+			}
+		}
+	}
+	return segments
+}
+
+// selectPath returns the values matching path segments below current; "*"
+// matches every key of a map and "[*]" every item of a list
+func selectPath(content any, current selectedValue, segments []string) []selectedValue {
+	if len(segments) == 0 {
+		current.value = content
+		return []selectedValue{current}
+	}
+
+	child := func(segment string) selectedValue {
+		return selectedValue{path: appendPath(current.path, segment)}
+	}
+
+	segment, rest := segments[0], segments[1:]
+	var matched []selectedValue
+	switch v := content.(type) {
+	case map[string]any:
+		if segment == "*" {
+			for _, key := range sortedKeys(v) {
+				matched = append(matched, selectPath(v[key], child(key), rest)...)
+			}
+		} else if value, ok := v[segment]; ok {
+			matched = append(matched, selectPath(value, child(segment), rest)...)
+		}
+	case []any:
+		switch {
+		case segment == "[*]":
+			for i, item := range v {
+				matched = append(matched, selectPath(item, child(fmt.Sprintf("[%d]", i)), rest)...)
+			}
+		case strings.HasPrefix(segment, "["):
+			index, err := strconv.Atoi(strings.Trim(segment, "[]"))
+			if err == nil && index < len(v) {
+				matched = append(matched, selectPath(v[index], child(segment), rest)...)
+			}
+		}
+	}
+	return matched
+}
+
+// ruleImages extracts images from a selected value: strings are matched
+// against the rule regex or taken as is, maps are read through the rule
+// fields, and lists are searched item by item. Images taken from a whole
+// value or from map fields can be overridden with --set; images pulled out of
+// a longer string by a regex cannot.
+func ruleImages(rule config.ExtractionRule, selected selectedValue) []discoveredImage {
+	newImage := func(name string, fields []setField) discoveredImage {
+		return discoveredImage{image: newContainerImage(name, ""), path: selected.path, fields: fields}
+	}
+
+	switch v := selected.value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		if rule.Pattern == nil {
+			return []discoveredImage{newImage(v, []setField{{value: v}})}
+		}
+
+		var images []discoveredImage
+		for _, match := range rule.Pattern.FindAllStringSubmatch(v, -1) {
+			group := func(field string) string {
+				if name, ok := rule.Fields[field]; ok {
+					return match[rule.Pattern.SubexpIndex(name)]
+				}
+				return ""
+			}
+			name := ruleImageName(group)
+			// Without mapped fields, the "image" group, the first group or the whole match is the image
+			switch {
+			case name != "":
+			case rule.Pattern.SubexpIndex("image") > 0:
+				name = match[rule.Pattern.SubexpIndex("image")]
+			case len(match) > 1:
+				name = match[1]
+			default:
+				name = match[0]
+			}
+			if name != "" {
+				images = append(images, newImage(name, nil))
+			}
+		}
+		return images
+
+	case map[string]any:
+		var fields []setField
+		field := func(field string) string {
+			key := field
+			if mapped, ok := rule.Fields[field]; ok {
+				key = mapped
+			}
+			value := scalarString(v[key])
+			if value != "" {
+				fields = append(fields, setField{key: key, value: value})
+			}
+			return value
+		}
+		if name := ruleImageName(field); name != "" {
+			return []discoveredImage{newImage(name, fields)}
+		}
+
+	case []any:
+		var images []discoveredImage
+		for i, item := range v {
+			images = append(images, ruleImages(rule, selectedValue{value: item, path: appendPath(selected.path, fmt.Sprintf("[%d]", i))})...)
+		}
+		return images
+	}
+	return nil
+}
+
+// ruleImageName builds an image name from the parts returned by field: a
+// complete "image" or a repository with optional registry, tag and digest
+func ruleImageName(field func(string) string) string {
+	if image := field("image"); image != "" {
+		return image
+	}
+	repository := field("repository")
+	if repository == "" {
+		return ""
+	}
+	return joinImageName(field("registry"), repository, field("tag"), field("digest"))
+}
+
+// sortedKeys returns the keys of a map in lexical order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
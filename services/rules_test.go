@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	"helm-viewer/config"
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// compileRules compiles extraction rules like config.LoadExtractionRules
+func compileRules(t *testing.T, rules ...config.ExtractionRule) []config.ExtractionRule {
+	t.Helper()
+	for i := range rules {
+		require.NoError(t, rules[i].Compile())
+	}
+	return rules
+}
+
+func TestFindDocumentImages_ExtractionRules(t *testing.T) {
+	service := NewHELMService()
+	service.SetExtractionRules(compileRules(t,
+		config.ExtractionRule{Chart: "istio-operator", Path: "operator.config.defaultImages.*"},
+		config.ExtractionRule{
+			Path:   "$.spec.containers[*].args",
+			Regex:  `--sidecar-image=(?P<repo>[^:\s]+):(?P<version>\S+)`,
+			Fields: map[string]string{"repository": "repo", "tag": "version"},
+		},
+		config.ExtractionRule{
+			Path:   "proxy",
+			Fields: map[string]string{"repository": "hub", "tag": "version"},
+		},
+		config.ExtractionRule{Path: "spec.containers[0].image"},
+	))
+
+	content := map[string]any{
+		"operator": map[string]any{
+			"config": map[string]any{
+				"defaultImages": map[string]any{
+					"proxy": "docker.io/istio/proxyv2:1.20.0",
+					"pilot": "docker.io/istio/pilot:1.20.0",
+				},
+			},
+		},
+		"proxy": map[string]any{"hub": "quay.io/org/proxy", "version": "2.1"},
+		"spec": map[string]any{
+			"containers": []any{
+				map[string]any{
+					"image": "ghcr.io/org/app:1.0",
+					"args":  []any{"--verbose", "--sidecar-image=envoyproxy/envoy:v1.28.0"},
+				},
+			},
+		},
+	}
+
+	images := service.FindDocumentImages(models.YAMLDocument{Source: "values.yaml", Chart: "istio-operator", Content: content})
+	names := make([]string, 0, len(images))
+	for _, image := range images {
+		names = append(names, image.Name)
+		require.Equal(t, "values.yaml", image.Source)
+	}
+	require.Equal(t, []string{
+		"ghcr.io/org/app:1.0",
+		"docker.io/istio/pilot:1.20.0",
+		"docker.io/istio/proxyv2:1.20.0",
+		"envoyproxy/envoy:v1.28.0",
+		"quay.io/org/proxy:2.1",
+	}, names)
+
+	// Chart-scoped rules do not apply to other charts
+	images = service.FindDocumentImages(models.YAMLDocument{Chart: "other", Content: content})
+	require.Len(t, images, 3)
+
+	// nor to plain YAML documents, which have no chart
+	images = service.FindDocumentImages(models.YAMLDocument{Source: "values.yaml", Content: content})
+	require.Len(t, images, 3)
+}
+
+func TestRulePathSegments(t *testing.T) {
+	require.Equal(t, []string{"spec", "containers", "[*]", "args", "[0]"}, rulePathSegments("$.spec.containers[*].args[0]"))
+	require.Equal(t, []string{"*", "image"}, rulePathSegments("*.image"))
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"helm-viewer/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// userValues merges the values overrides of a request with Helm's precedence:
+// values files in order, then inline values, then --set expressions. Later
+// sources win, maps are merged recursively and nulls are kept so they can
+// remove chart defaults.
+func (s *HELMService) userValues(ctx context.Context, opts models.LoadOptions) (map[string]any, error) {
+	values := map[string]any{}
+
+	for _, url := range opts.ValuesFiles {
+		file, err := s.fetchValuesFile(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		values = mergeValues(values, file)
+	}
+
+	values = mergeValues(values, deepCopyMap(opts.Values))
+
+	for _, set := range opts.Set {
+		if err := parseSetValues(set, values); err != nil {
+			return nil, fmt.Errorf("invalid set value %q: %w", set, err)
+		}
+	}
+
+	return values, nil
+}
+
+// fetchValuesFile downloads and parses a values file
+func (s *HELMService) fetchValuesFile(ctx context.Context, url string) (map[string]any, error) {
+	resp, err := s.httpGet(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch values file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch values file %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %w", err)
+	}
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("values file exceeds %d bytes", maxDownloadSize)
+	}
+
+	values := map[string]any{}
+	if err := yaml.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("invalid values file %s: %w", url, err)
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	return values, nil
+}
+
+// lookupPath returns the value at a dotted path such as "redis.enabled"
+func lookupPath(values map[string]any, dotted string) any {
+	var current any = values
+	for _, key := range strings.Split(dotted, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// valuesFileName returns the name of the values file of a chart
+func (c *chart) valuesFileName() string {
+	if _, ok := c.files["values.yaml"]; !ok {
+		if _, ok := c.files["values.yml"]; ok {
+			return "values.yml"
+		}
+	}
+	return "values.yaml"
+}
+
+// chartValues parses the default values of a chart
+func chartValues(c *chart) (map[string]any, error) {
+	values := map[string]any{}
+	name := c.valuesFileName()
+	if content, ok := c.files[name]; ok {
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse chart file %s: invalid YAML format: %w", c.sourcePath(name), err)
+		}
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	return values, nil
+}
+
+// coalesceValues merges defaults into values; values win, nested maps are
+// merged and a null value removes the default, as in Helm
+func coalesceValues(values, defaults map[string]any) map[string]any {
+	if values == nil {
+		values = map[string]any{}
+	}
+	for key, def := range defaults {
+		current, exists := values[key]
+		switch {
+		case !exists:
+			values[key] = deepCopyValue(def)
+		case current == nil:
+			delete(values, key)
+		default:
+			currentMap, ok1 := current.(map[string]any)
+			defMap, ok2 := def.(map[string]any)
+			if ok1 && ok2 {
+				values[key] = coalesceValues(currentMap, defMap)
+			}
+		}
+	}
+	return values
+}
+
+// deepCopyMap copies a values map so coalescing does not modify the source
+func deepCopyMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	return deepCopyValue(m).(map[string]any)
+}
+
+// deepCopyValue copies maps and slices of a values tree
+func deepCopyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, value := range v {
+			copied[key] = deepCopyValue(value)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, value := range v {
+			copied[i] = deepCopyValue(value)
+		}
+		return copied
+	}
+	return v
+}
+
+// mergeValues merges src into dst; src wins, maps are merged recursively
+func mergeValues(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for key, value := range src {
+		srcMap, ok1 := value.(map[string]any)
+		dstMap, ok2 := dst[key].(map[string]any)
+		if ok1 && ok2 {
+			dst[key] = mergeValues(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+	return dst
+}
+
+// parseSetValues applies a Helm --set expression such as
+// "image.tag=1.2,args[0]=--debug,hosts={a,b}" to values. Dots, commas and
+// brackets in keys or values can be escaped with a backslash.
+func parseSetValues(expression string, values map[string]any) error {
+	for _, assignment := range splitUnescaped(expression, ',', true) {
+		if assignment == "" {
+			continue
+		}
+		key, value, ok := cutUnescaped(assignment, '=')
+		if !ok {
+			return fmt.Errorf("key %q has no value", assignment)
+		}
+
+		var parsed any
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			var list []any
+			for _, item := range splitUnescaped(value[1:len(value)-1], ',', false) {
+				list = append(list, typedSetValue(unescape(item)))
+			}
+			parsed = list
+		} else {
+			parsed = typedSetValue(unescape(value))
+		}
+
+		if err := setValuePath(values, key, parsed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValuePath sets a value at a --set key path such as "a.b[1].c"
+func setValuePath(values map[string]any, key string, value any) error {
+	parts := splitUnescaped(key, '.', false)
+	current := values
+	for i, part := range parts {
+		name, indexes, err := parseKeyIndexes(part)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return fmt.Errorf("key %q has an empty segment", key)
+		}
+		last := i == len(parts)-1
+
+		if len(indexes) == 0 {
+			if last {
+				current[name] = value
+				return nil
+			}
+			next, ok := current[name].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				current[name] = next
+			}
+			current = next
+			continue
+		}
+
+		// Walk the list indexes; the last one holds the value or the next map
+		parent := current
+		list, _ := parent[name].([]any)
+		parent[name] = setListPath(list, indexes, func(existing any) any {
+			if last {
+				return value
+			}
+			next, ok := existing.(map[string]any)
+			if !ok {
+				next = map[string]any{}
+			}
+			current = next
+			return next
+		})
+		if last {
+			return nil
+		}
+	}
+	return nil
+}
+
+// setListPath sets the element at nested list indexes, growing the lists as
+// needed; set receives the existing element and returns the new one
+func setListPath(list []any, indexes []int, set func(any) any) []any {
+	index := indexes[0]
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	if len(indexes) == 1 {
+		list[index] = set(list[index])
+		return list
+	}
+	nested, _ := list[index].([]any)
+	list[index] = setListPath(nested, indexes[1:], set)
+	return list
+}
+
+// maxSetListIndex bounds list indexes in --set keys, as Helm does
+const maxSetListIndex = 65536
+
+// parseKeyIndexes splits a key segment such as "args[0][1]" into its
+// unescaped name and indexes; escaped brackets belong to the name
+func parseKeyIndexes(segment string) (string, []int, error) {
+	name, rest, found := cutUnescaped(segment, '[')
+	name = unescape(name)
+	if !found {
+		return name, nil, nil
+	}
+
+	var indexes []int
+	for rest = "[" + rest; rest != ""; {
+		if !strings.HasPrefix(rest, "[") {
+			return "", nil, fmt.Errorf("invalid list index in %q", segment)
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated list index in %q", segment)
+		}
+		index, err := strconv.Atoi(rest[1:end])
+		if err != nil || index < 0 || index > maxSetListIndex {
+			return "", nil, fmt.Errorf("invalid list index in %q", segment)
+		}
+		indexes = append(indexes, index)
+		rest = rest[end+1:]
+	}
+	return name, indexes, nil
+}
+
+// typedSetValue converts a --set value to a bool, integer or null like Helm;
+// anything else stays a string
+func typedSetValue(value string) any {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	// Leading zeros mark strings such as "007", as in Helm
+	if value != "0" && strings.HasPrefix(value, "0") {
+		return value
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	return value
+}
+
+// splitUnescaped splits s at separators not preceded by a backslash, keeping
+// the escapes for later; with braces set, separators inside {...} are kept
+func splitUnescaped(s string, sep byte, braces bool) []string {
+	var parts []string
+	start, depth := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case braces && s[i] == '{':
+			depth++
+		case braces && s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutUnescaped cuts s around the first separator not preceded by a backslash
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape removes the backslashes escaping the following character
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSetValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       map[string]any
+	}{
+		{"nested key", "image.tag=1.2.3", map[string]any{"image": map[string]any{"tag": "1.2.3"}}},
+		{"several keys", "a=1,b=true,c=null,d=007", map[string]any{"a": int64(1), "b": true, "c": nil, "d": "007"}},
+		{"list index", "args[1]=--debug", map[string]any{"args": []any{nil, "--debug"}}},
+		{"map in list", "containers[0].image=nginx", map[string]any{"containers": []any{map[string]any{"image": "nginx"}}}},
+		{"list value", "hosts={a,b}", map[string]any{"hosts": []any{"a", "b"}}},
+		{"escaped brackets", `a\[0\]=x`, map[string]any{"a[0]": "x"}},
+		{"escaped separators", `annotations.example\.com/name=a\,b`, map[string]any{"annotations": map[string]any{"example.com/name": "a,b"}}},
+		{"value with equals", "args=--level=info", map[string]any{"args": "--level=info"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]any{}
+			require.NoError(t, parseSetValues(tt.expression, values))
+			require.Equal(t, tt.want, values)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, expression := range []string{"image", "a..b=1", "args[x]=1", "args[0=1"} {
+			require.Error(t, parseSetValues(expression, map[string]any{}), expression)
+		}
+	})
+}
+
+func TestUserValues_Precedence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/base.yaml":
+			w.Write([]byte("image:\n  repository: nginx\n  tag: \"1.0\"\nreplicas: 1\n"))
+		case "/prod.yaml":
+			w.Write([]byte("image:\n  tag: \"1.1\"\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	values, err := service.userValues(context.Background(), models.LoadOptions{
+		ValuesFiles: []string{server.URL + "/base.yaml", server.URL + "/prod.yaml"},
+		Values:      map[string]any{"image": map[string]any{"tag": "1.2", "pullPolicy": "Always"}},
+		Set:         []string{"image.tag=1.3"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"image":    map[string]any{"repository": "nginx", "tag": "1.3", "pullPolicy": "Always"},
+		"replicas": 1,
+	}, values)
+
+	_, err = service.userValues(context.Background(), models.LoadOptions{ValuesFiles: []string{server.URL + "/missing.yaml"}})
+	require.ErrorContains(t, err, "failed to fetch values file")
+
+	_, err = service.userValues(context.Background(), models.LoadOptions{Set: []string{"image"}})
+	require.ErrorContains(t, err, "invalid set value")
+}
+
+func TestLoadChartArchive_ValuesOverrides(t *testing.T) {
+	archive := buildChartArchive(t, map[string]string{
+		"mychart/Chart.yaml": `
+name: mychart
+dependencies:
+  - name: redis
+    condition: redis.enabled
+  - name: postgresql
+    condition: postgresql.enabled
+`,
+		"mychart/values.yaml":                   "image:\n  repository: nginx\n  tag: \"1.25\"\nredis:\n  enabled: true\npostgresql:\n  enabled: true\n",
+		"mychart/charts/redis/values.yaml":      "image:\n  repository: redis\n  tag: \"7.2\"\n",
+		"mychart/charts/postgresql/values.yaml": "image:\n  repository: postgres\n  tag: \"16\"\n",
+	})
+
+	values := map[string]any{
+		"image":      map[string]any{"tag": "1.26"},
+		"redis":      map[string]any{"image": map[string]any{"tag": "7.4"}},
+		"postgresql": map[string]any{"enabled": false},
+	}
+	docs, err := loadChartArchive(context.Background(), archive, values, models.LoadOptions{})
+	require.NoError(t, err)
+
+	service := NewHELMService()
+	found := map[string]string{}
+	for _, doc := range docs {
+		for _, image := range service.FindContainerImages(doc.Content) {
+			found[image.Name] = doc.Source
+		}
+	}
+	require.Equal(t, map[string]string{
+		"nginx:1.26": "mychart/values.yaml",
+		"redis:7.4":  "mychart/charts/redis/values.yaml",
+	}, found)
+}
+
+func TestLoadAndParseYAML_ValuesOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image:\n  repository: nginx\n  tag: \"1.25\"\n"))
+	}))
+	defer server.Close()
+
+	service := NewHELMService()
+	docs, err := service.LoadAndParseYAML(context.Background(), server.URL+"/values.yaml", models.LoadOptions{Set: []string{"image.tag=1.26"}})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	images := service.FindContainerImages(docs[0].Content)
+	require.Len(t, images, 1)
+	require.Equal(t, "nginx:1.26", images[0].Name)
+}
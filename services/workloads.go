@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"helm-viewer/models"
+	"helm-viewer/reference"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpecPaths are the paths of the pod spec in the workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// replicaPaths are the paths of the pod count of workload kinds; DaemonSets
+// run one pod per node and have none
+var replicaPaths = map[string][]string{
+	"Deployment":  {"spec", "replicas"},
+	"StatefulSet": {"spec", "replicas"},
+	"ReplicaSet":  {"spec", "replicas"},
+	"Job":         {"spec", "parallelism"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "parallelism"},
+}
+
+// containerLists are the container lists of a pod spec and the role of
+// their containers, in the order the kubelet starts them
+var containerLists = []struct {
+	key  string
+	role string
+}{
+	{"initContainers", models.ContainerRoleInit},
+	{"containers", models.ContainerRoleMain},
+	{"ephemeralContainers", models.ContainerRoleEphemeral},
+}
+
+// discoverWorkloadImages finds the images of the containers of a workload
+// manifest, labelled with their role, pull policy and the workload replicas;
+// other manifests have none
+func discoverWorkloadImages(root *yaml.Node) []discoveredImage {
+	kind := scalarValue(mappingValue(root, "kind"))
+	specPath, ok := podSpecPaths[kind]
+	if !ok || !isManifest(root) {
+		return nil
+	}
+	replicas := workloadReplicas(root, kind)
+
+	spec := root
+	for _, key := range specPath {
+		spec = mappingValue(spec, key)
+	}
+
+	var images []discoveredImage
+	for _, list := range containerLists {
+		containers := mappingValue(spec, list.key)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, container := range containers.Content {
+			key, value := mappingEntry(container, imageMapKey)
+			name := scalarValue(value)
+			if name == "" {
+				continue
+			}
+
+			image := newContainerImage(name, scalarValue(mappingValue(container, "name")))
+			image.Role = list.role
+			image.PullPolicy = pullPolicy(scalarValue(mappingValue(container, "imagePullPolicy")), image)
+			image.Replicas = replicas
+			images = append(images, discoveredImage{
+				image:  image,
+				path:   append(append([]string{}, specPath...), list.key, fmt.Sprintf("[%d]", i), imageMapKey),
+				line:   key.Line,
+				column: key.Column,
+				fields: []setField{{value: name}},
+			})
+		}
+	}
+	return images
+}
+
+// workloadReplicas returns the pod count of a workload, 1 when the manifest
+// does not set it, and nil for DaemonSets
+func workloadReplicas(root *yaml.Node, kind string) *int {
+	if kind == "DaemonSet" {
+		return nil
+	}
+
+	replicas := 1
+	if path, ok := replicaPaths[kind]; ok {
+		node := root
+		for _, key := range path {
+			node = mappingValue(node, key)
+		}
+		if value, err := strconv.Atoi(scalarValue(node)); err == nil && value >= 0 {
+			replicas = value
+		}
+	}
+	return &replicas
+}
+
+// pullPolicy returns the pull policy of a container, defaulted the way
+// Kubernetes does: Always for latest tags, IfNotPresent otherwise
+func pullPolicy(policy string, image models.ContainerImage) string {
+	switch {
+	case policy != "":
+		return policy
+	case image.Digest == "" && (image.Tag == "" || image.Tag == reference.DefaultTag):
+		return models.PullPolicyAlways
+	}
+	return models.PullPolicyIfNotPresent
+}
+
+// mergeDiscoveredImages appends to images the discovered images found at
+// paths images do not cover
+func mergeDiscoveredImages(images, discovered []discoveredImage) []discoveredImage {
+	covered := map[string]bool{}
+	for _, d := range images {
+		covered[formatPath(d.path)] = true
+	}
+	for _, d := range discovered {
+		if !covered[formatPath(d.path)] {
+			images = append(images, d)
+		}
+	}
+	return images
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+
+	"helm-viewer/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFindDocumentImages_Workloads(t *testing.T) {
+	source := `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: org/backup:1.4
+              imagePullPolicy: Always
+          initContainers:
+            - name: wait
+              image: busybox
+          ephemeralContainers:
+            - name: debug
+              image: busybox@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+  config:
+    sidecar:
+      image: envoyproxy/envoy:v1.29
+`
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(source), &node))
+
+	service := NewHELMService()
+	images := service.FindDocumentImages(models.YAMLDocument{Source: "cronjob.yaml", Content: &node, Node: &node})
+	require.Len(t, images, 4)
+
+	require.Equal(t, "busybox", images[0].Name)
+	require.Equal(t, "wait", images[0].Container)
+	require.Equal(t, models.ContainerRoleInit, images[0].Role)
+	require.Equal(t, models.PullPolicyAlways, images[0].PullPolicy)
+	require.Equal(t, "spec.jobTemplate.spec.template.spec.initContainers[0].image", images[0].Path)
+	require.Equal(t, 16, images[0].Line)
+
+	require.Equal(t, "org/backup:1.4", images[1].Name)
+	require.Equal(t, models.ContainerRoleMain, images[1].Role)
+	require.Equal(t, models.PullPolicyAlways, images[1].PullPolicy)
+	require.Equal(t, "CronJob/backup", images[1].Workload)
+
+	require.Equal(t, "debug", images[2].Container)
+	require.Equal(t, models.ContainerRoleEphemeral, images[2].Role)
+	require.Equal(t, models.PullPolicyIfNotPresent, images[2].PullPolicy)
+
+	// Images outside the pod spec are still found by the generic discovery
+	require.Equal(t, "envoyproxy/envoy:v1.29", images[3].Name)
+	require.Equal(t, "spec.config.sidecar.image", images[3].Path)
+	require.Empty(t, images[3].Role)
+	require.Empty(t, images[3].PullPolicy)
+}
+
+func TestFindDocumentImages_NonWorkloadManifest(t *testing.T) {
+	source := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  image: nginx:1.25
+`
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(source), &node))
+
+	service := NewHELMService()
+	images := service.FindDocumentImages(models.YAMLDocument{Source: "configmap.yaml", Content: &node, Node: &node})
+	require.Len(t, images, 1)
+	require.Empty(t, images[0].Workload)
+	require.Equal(t, "ConfigMap", images[0].Resource.Kind)
+}
+
+func TestDiscoverWorkloadImages_Kinds(t *testing.T) {
+	manifests := map[string]string{
+		"Pod":         "spec:\n  containers: [{name: app, image: 'nginx:1.25'}]",
+		"Deployment":  "spec:\n  template:\n    spec:\n      containers: [{name: app, image: 'nginx:1.25'}]",
+		"StatefulSet": "spec:\n  template:\n    spec:\n      containers: [{name: app, image: 'nginx:1.25'}]",
+		"DaemonSet":   "spec:\n  template:\n    spec:\n      containers: [{name: app, image: 'nginx:1.25'}]",
+		"ReplicaSet":  "spec:\n  template:\n    spec:\n      containers: [{name: app, image: 'nginx:1.25'}]",
+		"Job":         "spec:\n  template:\n    spec:\n      containers: [{name: app, image: 'nginx:1.25'}]",
+		"Service":     "spec:\n  containers: [{name: app, image: 'nginx:1.25'}]",
+	}
+	for kind, spec := range manifests {
+		var node yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte("apiVersion: v1\nkind: "+kind+"\nmetadata: {name: app}\n"+spec), &node))
+
+		images := discoverWorkloadImages(resolveNode(&node))
+		if kind == "Service" {
+			require.Empty(t, images, kind)
+			continue
+		}
+		require.Len(t, images, 1, kind)
+		require.Equal(t, "nginx:1.25", images[0].image.Name, kind)
+		require.Equal(t, models.ContainerRoleMain, images[0].image.Role, kind)
+		require.Equal(t, models.PullPolicyIfNotPresent, images[0].image.PullPolicy, kind)
+	}
+}
+
+func TestWorkloadReplicas(t *testing.T) {
+	manifests := map[string]*int{
+		"kind: Deployment\nspec: {replicas: 3}":                        intPtr(3),
+		"kind: StatefulSet\nspec: {replicas: 0}":                       intPtr(0),
+		"kind: Deployment\nspec: {replicas: '{{ .Values.replicas }}'}": intPtr(1),
+		"kind: ReplicaSet\nspec: {}":                                   intPtr(1),
+		"kind: Job\nspec: {parallelism: 4}":                            intPtr(4),
+		"kind: CronJob\nspec: {jobTemplate: {spec: {parallelism: 2}}}": intPtr(2),
+		"kind: Pod\nspec: {}":                                          intPtr(1),
+		"kind: DaemonSet\nspec: {template: {spec: {}}}":                nil,
+	}
+	for manifest, expected := range manifests {
+		var node yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(manifest), &node))
+		root := resolveNode(&node)
+		require.Equal(t, expected, workloadReplicas(root, scalarValue(mappingValue(root, "kind"))), manifest)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}